@@ -0,0 +1,157 @@
+// Command backfill starts enrichment runs for historical incidents read from
+// an NDJSON file of IncidentInput records, one per line.
+//
+//	backfill -in incidents.ndjson -report report.ndjson -rate 2 -label prompts-v2
+//
+// Idempotency keys are derived from -label and each record, so rerunning the
+// same file returns the runs already started; change -label to enrich the
+// same incidents again. The report holds one JSON line per record with its
+// run id or error.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/config"
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/incidents"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// reportLine is one record's outcome in the report.
+type reportLine struct {
+	Line           int    `json:"line"`
+	IncidentID     string `json:"incident_id,omitempty"`
+	WorkflowID     string `json:"workflow_id,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	RunID          string `json:"run_id,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+func main() {
+	in := flag.String("in", "-", "NDJSON file of IncidentInput records (- for stdin)")
+	reportPath := flag.String("report", "-", "report file (- for stdout)")
+	rate := flag.Float64("rate", 2, "StartRun calls per second")
+	label := flag.String("label", "backfill", "idempotency key prefix; change it to start new runs for the same records")
+	workflowID := flag.String("workflow", "incident-enricher.enrich", "workflow for trigger records")
+	updateWorkflowID := flag.String("update-workflow", "incident-enricher.update", "workflow for update and resolve records")
+	defaultMode := flag.String("destination-mode", "artifact", "destination.mode for records without one")
+	dryRun := flag.Bool("dry-run", false, "validate records and write the report without starting runs")
+	flag.Parse()
+	if *rate <= 0 {
+		log.Fatal("backfill: -rate must be positive")
+	}
+
+	cfg := config.Load("backfill")
+	gw := gatewayclient.New(cfg.GatewayURL, cfg.APIKey)
+
+	input := io.Reader(os.Stdin)
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatalf("backfill: %v", err)
+		}
+		defer f.Close()
+		input = f
+	}
+	out := io.Writer(os.Stdout)
+	if *reportPath != "-" {
+		f, err := os.Create(*reportPath)
+		if err != nil {
+			log.Fatalf("backfill: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	started, failed, err := backfill(ctx, gw, input, out, options{
+		label:            *label,
+		workflowID:       *workflowID,
+		updateWorkflowID: *updateWorkflowID,
+		defaultMode:      *defaultMode,
+		defaultWebhook:   cfg.SlackWebhookURL,
+		dryRun:           *dryRun,
+		interval:         time.Duration(float64(time.Second) / *rate),
+	})
+	log.Printf("backfill: %d ok, %d failed", started, failed)
+	if err != nil {
+		log.Fatalf("backfill: %v", err)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// options shape the run started for each record.
+type options struct {
+	label            string
+	workflowID       string
+	updateWorkflowID string
+	defaultMode      string
+	defaultWebhook   string
+	dryRun           bool
+	// interval spaces the StartRun calls.
+	interval time.Duration
+}
+
+// backfill starts a run for each record of in and writes every record's
+// outcome to out. Records that do not decode, fail validation or are
+// rejected by the gateway are reported and counted as failed without
+// stopping the rest.
+func backfill(ctx context.Context, gw *gatewayclient.Client, in io.Reader, out io.Writer, opts options) (started, failed int, err error) {
+	report := json.NewEncoder(out)
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+
+	err = incidents.ReadNDJSON(in, func(line int, incident types.IncidentInput, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		result := reportLine{Line: line, IncidentID: incident.IncidentID}
+		if err == nil {
+			if incident.Destination.Mode == "" {
+				incident.Destination.Mode = opts.defaultMode
+				incident.Destination.SlackWebhookURL = opts.defaultWebhook
+			}
+			if incident.EventType == "" {
+				incident.EventType = types.EventTrigger
+			}
+			incidents.Normalize(&incident)
+			err = incidents.ValidateInput(incident)
+		}
+		if err == nil {
+			result.WorkflowID = opts.workflowID
+			if incident.EventType != types.EventTrigger {
+				result.WorkflowID = opts.updateWorkflowID
+			}
+			result.IdempotencyKey = incidents.IdempotencyKey(opts.label, incident)
+			if !opts.dryRun {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-ticker.C:
+				}
+				result.RunID, err = gw.StartRun(ctx, result.WorkflowID, incidents.ToMap(incident), result.IdempotencyKey)
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		} else {
+			started++
+		}
+		return report.Encode(result)
+	})
+	return started, failed, err
+}
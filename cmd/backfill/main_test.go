@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+)
+
+const records = `{"incident_id":"inc-1","title":"Disk full","source":{"system":"pagerduty"}}
+{"incident_id":"inc-2",
+
+{"incident_id":"inc-3","severity":"sev9","source":{"system":"pagerduty"}}
+{"incident_id":"inc-rejected","source":{"system":"pagerduty"}}
+{"incident_id":"inc-1","event_type":"RESOLVE","source":{"system":"PagerDuty"}}
+`
+
+// startRunGateway starts runs named after the incident and the workflow,
+// rejecting incidents whose id ends in -rejected, and records every
+// idempotency key it sees.
+func startRunGateway(t *testing.T) (*gatewayclient.Client, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			IncidentID string `json:"incident_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&input)
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		mu.Unlock()
+		if strings.HasSuffix(input.IncidentID, "-rejected") {
+			http.Error(w, "workflow input rejected", http.StatusBadRequest)
+			return
+		}
+		workflow := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/workflows/"), "/runs")
+		_ = json.NewEncoder(w).Encode(map[string]string{"run_id": input.IncidentID + "@" + workflow})
+	}))
+	t.Cleanup(srv.Close)
+	return gatewayclient.New(srv.URL, ""), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), keys...)
+	}
+}
+
+var testOptions = options{
+	label:            "backfill",
+	workflowID:       "enrich",
+	updateWorkflowID: "update",
+	defaultMode:      "artifact",
+	interval:         time.Millisecond,
+}
+
+func runBackfill(t *testing.T, gw *gatewayclient.Client, opts options) ([]reportLine, int, int) {
+	t.Helper()
+	var out bytes.Buffer
+	started, failed, err := backfill(context.Background(), gw, strings.NewReader(records), &out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report []reportLine
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var line reportLine
+		if err := dec.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		report = append(report, line)
+	}
+	return report, started, failed
+}
+
+func TestBackfillPartialFailures(t *testing.T) {
+	gw, keys := startRunGateway(t)
+	report, started, failed := runBackfill(t, gw, testOptions)
+	if started != 2 || failed != 3 {
+		t.Errorf("%d started, %d failed; want 2 and 3", started, failed)
+	}
+	want := []struct {
+		line     int
+		incident string
+		runID    string
+		err      string
+	}{
+		{line: 1, incident: "inc-1", runID: "inc-1@enrich"},
+		{line: 2, err: "invalid json"},
+		{line: 4, incident: "inc-3", err: "severity: must be one of"},
+		{line: 5, incident: "inc-rejected", err: "workflow input rejected"},
+		{line: 6, incident: "inc-1", runID: "inc-1@update"},
+	}
+	if len(report) != len(want) {
+		t.Fatalf("report has %d lines, want %d: %+v", len(report), len(want), report)
+	}
+	for i, w := range want {
+		got := report[i]
+		if got.Line != w.line || got.IncidentID != w.incident || got.RunID != w.runID || !strings.Contains(got.Error, w.err) || (w.err == "") != (got.Error == "") {
+			t.Errorf("report line %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if len(keys()) != 3 {
+		t.Errorf("gateway got %d StartRun calls, want one per valid record", len(keys()))
+	}
+}
+
+func TestBackfillIdempotencyKeys(t *testing.T) {
+	gw, keys := startRunGateway(t)
+	first, _, _ := runBackfill(t, gw, testOptions)
+	rerun, _, _ := runBackfill(t, gw, testOptions)
+	relabelled := testOptions
+	relabelled.label = "prompts-v2"
+	relabel, _, _ := runBackfill(t, gw, relabelled)
+
+	for i := range first {
+		if first[i].IdempotencyKey != rerun[i].IdempotencyKey {
+			t.Errorf("line %d: rerun key %q differs from %q", first[i].Line, rerun[i].IdempotencyKey, first[i].IdempotencyKey)
+		}
+		if first[i].IdempotencyKey == "" {
+			continue
+		}
+		if !strings.HasPrefix(first[i].IdempotencyKey, "backfill:"+first[i].IncidentID+":") {
+			t.Errorf("line %d: key %q does not name the label and incident", first[i].Line, first[i].IdempotencyKey)
+		}
+		if relabel[i].IdempotencyKey == first[i].IdempotencyKey || !strings.HasPrefix(relabel[i].IdempotencyKey, "prompts-v2:") {
+			t.Errorf("line %d: relabelled key %q", first[i].Line, relabel[i].IdempotencyKey)
+		}
+	}
+	// The trigger and resolve for inc-1 are different records.
+	if first[0].IdempotencyKey == first[4].IdempotencyKey {
+		t.Error("trigger and resolve of one incident share a key")
+	}
+	if got := keys(); len(got) != 9 || got[0] != first[0].IdempotencyKey {
+		t.Errorf("gateway keys = %v, want the reported keys on every run", got)
+	}
+}
+
+func TestBackfillDryRun(t *testing.T) {
+	gw, keys := startRunGateway(t)
+	opts := testOptions
+	opts.dryRun = true
+	report, started, failed := runBackfill(t, gw, opts)
+	if len(keys()) != 0 {
+		t.Errorf("dry run made %d StartRun calls", len(keys()))
+	}
+	// Only decoding and validation fail without the gateway.
+	if started != 3 || failed != 2 {
+		t.Errorf("%d ok, %d failed; want 3 and 2", started, failed)
+	}
+	if report[0].IdempotencyKey == "" || report[0].RunID != "" {
+		t.Errorf("dry-run line = %+v, want a key and no run", report[0])
+	}
+}
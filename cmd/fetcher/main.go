@@ -2,86 +2,36 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
-	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
-	"github.com/coretexos/cap/v2/sdk/go/worker"
-	"github.com/coretexos/coretex-incident-enricher/internal/config"
-	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
 	"github.com/coretexos/coretex-incident-enricher/internal/incidents"
 	"github.com/coretexos/coretex-incident-enricher/internal/policyconstraints"
-	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/runtime"
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
-	"github.com/nats-io/nats.go"
 )
 
 func main() {
-	cfg := config.Load("fetcher")
-
-	nc, err := nats.Connect(cfg.NATSURL)
+	rt, err := runtime.New("fetcher")
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer nc.Close()
-
-	mem, err := store.New(cfg.RedisURL, cfg.DataTTL)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	gw := gatewayclient.New(cfg.GatewayURL, cfg.APIKey)
-
-	handler := func(ctx context.Context, req *agentv1.JobRequest) (*agentv1.JobResult, error) {
-		start := time.Now()
-		ctxPtr := req.GetContextPtr()
-		if ctxPtr == "" && req.Env != nil {
-			ctxPtr = req.Env["context_ptr"]
+	defer rt.Close()
+
+	handler := func(ctx context.Context, input types.IncidentInput) (types.EvidenceBundle, []string, error) {
+		if err := incidents.ValidateInput(input); err != nil {
+			var invalid *incidents.ValidationError
+			if errors.As(err, &invalid) {
+				err = failure.New(failure.Validation, err)
+			}
+			return types.EvidenceBundle{}, nil, err
 		}
-		var input types.IncidentInput
-		if err := mem.GetContextJSON(ctx, ctxPtr, &input); err != nil {
-			return nil, err
-		}
-		maxBytes := policyconstraints.MaxArtifactBytes(req.Env)
-		bundle, artifacts, err := incidents.MockEvidence(ctx, gw, input, maxBytes)
-		if err != nil {
-			return nil, err
-		}
-		resultPtr, err := mem.PutResultJSON(ctx, req.GetJobId(), bundle)
-		if err != nil {
-			return nil, err
-		}
-		return &agentv1.JobResult{
-			JobId:        req.GetJobId(),
-			Status:       agentv1.JobStatus_JOB_STATUS_SUCCEEDED,
-			ResultPtr:    resultPtr,
-			WorkerId:     cfg.WorkerID,
-			ExecutionMs:  time.Since(start).Milliseconds(),
-			ArtifactPtrs: artifacts,
-		}, nil
+		maxBytes := policyconstraints.MaxArtifactBytes(runtime.Job(ctx).GetEnv())
+		return incidents.MockEvidence(ctx, rt.Gateway, input, maxBytes)
 	}
 
-	subject := fmt.Sprintf("worker.%s.jobs", cfg.WorkerID)
-	w := &worker.Worker{
-		NATS:     nc,
-		Subject:  subject,
-		Handler:  handler,
-		SenderID: cfg.WorkerID,
-	}
-	if err := w.Start(); err != nil {
+	if err := runtime.Run(rt, "job.incident-enricher.fetch", handler); err != nil {
 		log.Fatal(err)
 	}
-
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-	go worker.HeartbeatLoop(ctx, nc, func() ([]byte, error) {
-		return worker.HeartbeatPayload(cfg.WorkerID, cfg.WorkerPool, 0, cfg.MaxParallelJobs, 0)
-	})
-
-	log.Printf("fetcher listening on %s for job.incident-enricher.fetch (worker_id=%s pool=%s)", subject, cfg.WorkerID, cfg.WorkerPool)
-	<-ctx.Done()
 }
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/incidents"
+	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// alertmanagerWebhook is the Alertmanager webhook payload (version "4").
+type alertmanagerWebhook struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []alertmanagerAlert `json:"alerts"`
+}
+
+type alertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt"`
+	EndsAt       string            `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// alertmanagerIncident is one run to start: the incident input and the
+// idempotency key derived from the group key and alert fingerprints.
+type alertmanagerIncident struct {
+	Input       types.IncidentInput
+	Idempotency string
+
+	groupKey string
+	// alertSet is the sorted, comma-joined fingerprints of the alerts.
+	alertSet string
+}
+
+// setEventType changes the incident's event type and the idempotency key
+// that includes it.
+func (i *alertmanagerIncident) setEventType(eventType string) {
+	i.Input.EventType = eventType
+	i.Idempotency = alertmanagerIdempotency(eventType, i.groupKey, i.alertSet)
+}
+
+// severityRank orders the severity enum so a group takes its worst alert.
+var severityRank = map[string]int{"low": 1, "medium": 2, "high": 3, "critical": 4}
+
+func parseAlertmanagerWebhook(body []byte) (alertmanagerWebhook, error) {
+	var payload alertmanagerWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return alertmanagerWebhook{}, fmt.Errorf("decode alertmanager webhook: %w", err)
+	}
+	if payload.Version != "" && payload.Version != "4" {
+		return alertmanagerWebhook{}, fmt.Errorf("unsupported alertmanager webhook version %q", payload.Version)
+	}
+	if payload.GroupKey == "" {
+		return alertmanagerWebhook{}, fmt.Errorf("alertmanager webhook missing groupKey")
+	}
+	return payload, nil
+}
+
+// buildAlertmanagerIncidents turns the firing (or, with resolved set, the
+// resolved) alerts of a notification into incident inputs: one for the whole
+// group, or one per alert when split is set.
+func buildAlertmanagerIncidents(payload alertmanagerWebhook, split, resolved bool, defaultMode, defaultWebhook string) []alertmanagerIncident {
+	var selected []alertmanagerAlert
+	for _, alert := range payload.Alerts {
+		if (alert.Status == "resolved") != resolved {
+			continue
+		}
+		selected = append(selected, alert)
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+	eventType := types.EventTrigger
+	if resolved {
+		eventType = types.EventResolve
+	}
+	if !split {
+		return []alertmanagerIncident{alertmanagerIncidentFor(payload, selected, payload.GroupKey, eventType, defaultMode, defaultWebhook)}
+	}
+	out := make([]alertmanagerIncident, 0, len(selected))
+	for _, alert := range selected {
+		incidentKey := payload.GroupKey + ":" + alert.Fingerprint
+		out = append(out, alertmanagerIncidentFor(payload, []alertmanagerAlert{alert}, incidentKey, eventType, defaultMode, defaultWebhook))
+	}
+	return out
+}
+
+// alertmanagerIncidentFor keeps the incident ID stable for incidentKey while
+// the idempotency key changes whenever the set of alerts does. In grouped
+// mode alertGroups turns a changed set into an update for that incident.
+func alertmanagerIncidentFor(payload alertmanagerWebhook, alerts []alertmanagerAlert, incidentKey, eventType, defaultMode, defaultWebhook string) alertmanagerIncident {
+	fingerprints := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		fingerprints = append(fingerprints, alert.Fingerprint)
+	}
+	sort.Strings(fingerprints)
+	alertSet := strings.Join(fingerprints, ",")
+	idSum := sha256.Sum256([]byte(incidentKey))
+
+	severity := ""
+	for _, alert := range alerts {
+		if s := alertmanagerSeverity(alert.Labels); severityRank[s] > severityRank[severity] {
+			severity = s
+		}
+	}
+
+	url := payload.ExternalURL
+	if len(alerts) == 1 && alerts[0].GeneratorURL != "" {
+		url = alerts[0].GeneratorURL
+	}
+
+	return alertmanagerIncident{
+		Input: types.IncidentInput{
+			IncidentID: "am-" + hex.EncodeToString(idSum[:6]),
+			EventType:  eventType,
+			Title:      alertmanagerTitle(payload, alerts),
+			Severity:   severity,
+			Source: types.SourceInfo{
+				System: "alertmanager",
+				URL:    url,
+			},
+			Raw: alertmanagerRaw(payload, alerts),
+			Destination: types.Destination{
+				Mode:            defaultMode,
+				SlackWebhookURL: defaultWebhook,
+			},
+		},
+		Idempotency: alertmanagerIdempotency(eventType, payload.GroupKey, alertSet),
+		groupKey:    payload.GroupKey,
+		alertSet:    alertSet,
+	}
+}
+
+func alertmanagerIdempotency(eventType, groupKey, alertSet string) string {
+	sum := sha256.Sum256([]byte(eventType + ":" + groupKey + ":" + alertSet))
+	return "alertmanager:" + hex.EncodeToString(sum[:])
+}
+
+// alertGroups remembers the alert set last reported for each grouped
+// Alertmanager incident. Alertmanager re-sends the whole group whenever it
+// changes, and the incident ID follows the group key, so a second trigger
+// would start an enrich run whose summary the poster drops as a repeat of
+// the first post. A nil alertGroups (no Redis) pins the trigger's
+// idempotency key to the group instead: repeats attach to the first run and
+// later changes to the set are not reported.
+type alertGroups struct {
+	mem *store.Store
+}
+
+// alertGroupRecord is the alert set last sent for an incident and the event
+// type it was sent as, so repeats of it reuse the same idempotency key.
+type alertGroupRecord struct {
+	AlertSet  string `json:"alert_set"`
+	EventType string `json:"event_type"`
+}
+
+// track sets the event type of a grouped incident: the first firing set is
+// a trigger, a different set an update, and a repeat keeps the type it was
+// first sent as. A resolve forgets the group so a re-fire triggers again.
+func (g *alertGroups) track(ctx context.Context, incident *alertmanagerIncident) error {
+	if g == nil {
+		if incident.Input.EventType == types.EventTrigger {
+			incident.Idempotency = alertmanagerIdempotency(types.EventTrigger, incident.groupKey, "")
+		}
+		return nil
+	}
+	key := alertGroupKey(incident.Input.IncidentID)
+	if incident.Input.EventType == types.EventResolve {
+		return g.mem.DeleteKey(ctx, key)
+	}
+	rec := alertGroupRecord{AlertSet: incident.alertSet, EventType: types.EventTrigger}
+	claimed, err := g.mem.ClaimJSON(ctx, key, rec, g.mem.TTL())
+	if err != nil || claimed {
+		return err
+	}
+	var prev alertGroupRecord
+	if _, err := g.mem.GetJSON(ctx, key, &prev); err != nil {
+		return err
+	}
+	if prev.AlertSet == rec.AlertSet {
+		rec.EventType = prev.EventType
+	} else {
+		rec.EventType = types.EventUpdate
+		if err := g.mem.PutJSON(ctx, key, rec); err != nil {
+			return err
+		}
+	}
+	incident.setEventType(rec.EventType)
+	return nil
+}
+
+func alertGroupKey(incidentID string) string {
+	return "incident-enricher:ingest:alertmanager:" + incidentID
+}
+
+// alertmanagerSeverity maps the conventional severity (or priority) label
+// onto the workflow's severity enum.
+func alertmanagerSeverity(labels map[string]string) string {
+	value := labels["severity"]
+	if value == "" {
+		value = labels["priority"]
+	}
+	return incidents.NormalizeSeverity(value)
+}
+
+func alertmanagerTitle(payload alertmanagerWebhook, alerts []alertmanagerAlert) string {
+	first := alerts[0]
+	candidates := []string{first.Annotations["summary"], first.Labels["alertname"]}
+	if len(alerts) > 1 {
+		candidates = []string{
+			payload.CommonAnnotations["summary"],
+			payload.CommonLabels["alertname"],
+			payload.GroupLabels["alertname"],
+			first.Labels["alertname"],
+		}
+	}
+	title := ""
+	for _, c := range candidates {
+		if c = strings.TrimSpace(c); c != "" {
+			title = c
+			break
+		}
+	}
+	if len(alerts) > 1 {
+		title = fmt.Sprintf("%s (%d alerts)", title, len(alerts))
+	}
+	return strings.TrimSpace(title)
+}
+
+func alertmanagerRaw(payload alertmanagerWebhook, alerts []alertmanagerAlert) map[string]any {
+	items := make([]map[string]any, 0, len(alerts))
+	messages := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		items = append(items, map[string]any{
+			"status":        alert.Status,
+			"labels":        alert.Labels,
+			"annotations":   alert.Annotations,
+			"starts_at":     alert.StartsAt,
+			"generator_url": alert.GeneratorURL,
+			"fingerprint":   alert.Fingerprint,
+		})
+		msg := alert.Annotations["description"]
+		if msg == "" {
+			msg = alert.Annotations["summary"]
+		}
+		if msg == "" {
+			msg = alert.Labels["alertname"]
+		}
+		if msg = strings.TrimSpace(msg); msg != "" {
+			messages = append(messages, msg)
+		}
+	}
+	return map[string]any{
+		"group_key":          payload.GroupKey,
+		"receiver":           payload.Receiver,
+		"status":             payload.Status,
+		"group_labels":       payload.GroupLabels,
+		"common_labels":      payload.CommonLabels,
+		"common_annotations": payload.CommonAnnotations,
+		"truncated_alerts":   payload.TruncatedAlerts,
+		"alerts":             items,
+		"message":            strings.Join(messages, "\n"),
+	}
+}
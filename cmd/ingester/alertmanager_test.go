@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+func TestAlertmanagerFixture(t *testing.T) {
+	payload, err := parseAlertmanagerWebhook(readFixture(t, "alertmanager_webhook.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("grouped", func(t *testing.T) {
+		firing := buildAlertmanagerIncidents(payload, false, false, "artifact", "")
+		if len(firing) != 1 {
+			t.Fatalf("got %d incidents, want 1 for the group", len(firing))
+		}
+		input := mustPrepare(t, firing[0].Input)
+		if input.EventType != types.EventTrigger {
+			t.Errorf("event_type = %q, want trigger", input.EventType)
+		}
+		if input.Severity != "critical" {
+			t.Errorf("severity = %q, want the group's worst, critical", input.Severity)
+		}
+		if input.Title != "Payments API p99 latency above 2s (2 alerts)" {
+			t.Errorf("title = %q", input.Title)
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		incidents := buildAlertmanagerIncidents(payload, true, false, "artifact", "")
+		incidents = append(incidents, buildAlertmanagerIncidents(payload, true, true, "artifact", "")...)
+		want := []string{types.EventTrigger, types.EventTrigger, types.EventResolve}
+		if len(incidents) != len(want) {
+			t.Fatalf("got %d incidents, want %d", len(incidents), len(want))
+		}
+		ids := map[string]bool{}
+		for i, incident := range incidents {
+			input := mustPrepare(t, incident.Input)
+			if input.EventType != want[i] {
+				t.Errorf("incident %d: event_type = %q, want %q", i, input.EventType, want[i])
+			}
+			ids[input.IncidentID] = true
+		}
+		if len(ids) != len(incidents) {
+			t.Errorf("split incidents share IDs: %v", ids)
+		}
+	})
+
+	t.Run("grouped without redis pins the trigger key", func(t *testing.T) {
+		first := buildAlertmanagerIncidents(payload, false, false, "artifact", "")[0]
+		fewer := payload
+		fewer.Alerts = payload.Alerts[:1]
+		second := buildAlertmanagerIncidents(fewer, false, false, "artifact", "")[0]
+		if first.Idempotency == second.Idempotency {
+			t.Fatal("alert sets differ but idempotency keys match before tracking")
+		}
+		var groups *alertGroups
+		for _, incident := range []*alertmanagerIncident{&first, &second} {
+			if err := groups.track(context.Background(), incident); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if first.Idempotency != second.Idempotency || first.Input.IncidentID != second.Input.IncidentID {
+			t.Errorf("grouped triggers got keys %q and %q", first.Idempotency, second.Idempotency)
+		}
+	})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultSignatureTolerance = 5 * time.Minute
+
+// authFile is the per-route authentication config loaded from
+// INGESTER_AUTH_FILE. Routes are the path segment after /webhook/; the "*"
+// route applies to any route without its own entry. Secret values of the
+// form "env:NAME" are read from the environment.
+type authFile struct {
+	Routes map[string]*routeAuth `json:"routes"`
+}
+
+type routeAuth struct {
+	BearerTokens []string    `json:"bearer_tokens"`
+	HMAC         *hmacAuth   `json:"hmac"`
+	ClientCert   *clientCert `json:"client_cert"`
+}
+
+// hmacAuth verifies an HMAC-SHA256 body signature. Style selects the wire
+// format: "generic" (configurable headers), "pagerduty", "slack" or "github".
+type hmacAuth struct {
+	Style           string   `json:"style"`
+	Secrets         []string `json:"secrets"`
+	Header          string   `json:"header"`
+	TimestampHeader string   `json:"timestamp_header"`
+	Tolerance       string   `json:"tolerance"`
+
+	tolerance time.Duration
+}
+
+// clientCert requires a verified TLS client certificate, optionally with a
+// subject common name or DNS SAN from AllowedNames.
+type clientCert struct {
+	AllowedNames []string `json:"allowed_names"`
+}
+
+// authError is a rejection with a short reason used for counting and logs.
+type authError struct {
+	reason string
+}
+
+func (e *authError) Error() string { return e.reason }
+
+func loadAuth(path string) (map[string]*routeAuth, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read auth config: %w", err)
+	}
+	var file authFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode auth config %s: %w", path, err)
+	}
+	for route, auth := range file.Routes {
+		if auth == nil {
+			return nil, fmt.Errorf("auth %q: empty route", route)
+		}
+		if err := auth.compile(); err != nil {
+			return nil, fmt.Errorf("auth %q: %w", route, err)
+		}
+	}
+	if file.Routes == nil {
+		file.Routes = map[string]*routeAuth{}
+	}
+	return file.Routes, nil
+}
+
+func (a *routeAuth) compile() error {
+	for i, token := range a.BearerTokens {
+		a.BearerTokens[i] = resolveSecret(token)
+		if a.BearerTokens[i] == "" {
+			return fmt.Errorf("bearer token %d is empty", i)
+		}
+	}
+	if a.HMAC == nil {
+		return nil
+	}
+	h := a.HMAC
+	if h.Style == "" {
+		h.Style = "generic"
+	}
+	switch h.Style {
+	case "generic":
+		if h.Header == "" {
+			h.Header = "X-Signature"
+		}
+	case "pagerduty", "slack", "github":
+	default:
+		return fmt.Errorf("unknown hmac style %q", h.Style)
+	}
+	if len(h.Secrets) == 0 {
+		return errors.New("hmac needs at least one secret")
+	}
+	for i, secret := range h.Secrets {
+		h.Secrets[i] = resolveSecret(secret)
+		if h.Secrets[i] == "" {
+			return fmt.Errorf("hmac secret %d is empty", i)
+		}
+	}
+	h.tolerance = defaultSignatureTolerance
+	if h.Tolerance != "" {
+		d, err := time.ParseDuration(h.Tolerance)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid hmac tolerance %q", h.Tolerance)
+		}
+		h.tolerance = d
+	}
+	return nil
+}
+
+func resolveSecret(value string) string {
+	if name, ok := strings.CutPrefix(strings.TrimSpace(value), "env:"); ok {
+		return strings.TrimSpace(os.Getenv(name))
+	}
+	return strings.TrimSpace(value)
+}
+
+// withAuth authenticates requests for the route named by routeOf before
+// handing them to next. The body is read once for signature checks and
+// replayed to next. routeOf must map paths without a route to unknownRoute:
+// the route keys the auth config and the rejection counter, which must not
+// grow with attacker-chosen paths.
+func withAuth(auths map[string]*routeAuth, routeOf func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		auth, ok := auths[route]
+		if !ok {
+			auth = auths["*"]
+		}
+		if auth == nil {
+			next(w, r)
+			return
+		}
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		if err := auth.verify(r, body, time.Now()); err != nil {
+			reason := "error"
+			var ae *authError
+			if errors.As(err, &ae) {
+				reason = ae.reason
+			}
+			authRejections.Inc(route, reason)
+			log.Printf("ingester: rejected %s %q (route %s) from %s: %s", r.Method, r.URL.Path, route, r.RemoteAddr, err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+// verify applies every configured check; all of them must pass.
+func (a *routeAuth) verify(r *http.Request, body []byte, now time.Time) error {
+	if a.ClientCert != nil {
+		if err := a.ClientCert.verify(r); err != nil {
+			return err
+		}
+	}
+	if len(a.BearerTokens) > 0 {
+		if err := verifyBearer(r, a.BearerTokens); err != nil {
+			return err
+		}
+	}
+	if a.HMAC != nil {
+		if err := a.HMAC.verify(r, body, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyBearer(r *http.Request, tokens []string) error {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return &authError{"missing_bearer"}
+	}
+	token = strings.TrimSpace(token)
+	for _, want := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1 {
+			return nil
+		}
+	}
+	return &authError{"bad_bearer"}
+}
+
+func (c *clientCert) verify(r *http.Request) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return &authError{"missing_client_cert"}
+	}
+	if len(c.AllowedNames) == 0 {
+		return nil
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	names := append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+	for _, allowed := range c.AllowedNames {
+		for _, name := range names {
+			if name != "" && name == allowed {
+				return nil
+			}
+		}
+	}
+	return &authError{"client_cert_not_allowed"}
+}
+
+func (h *hmacAuth) verify(r *http.Request, body []byte, now time.Time) error {
+	switch h.Style {
+	case "pagerduty":
+		header := r.Header.Get(pagerDutySignatureHeader)
+		if header == "" {
+			return &authError{"missing_signature"}
+		}
+		for _, secret := range h.Secrets {
+			if verifyPagerDutySignature(header, body, secret) {
+				return nil
+			}
+		}
+		return &authError{"bad_signature"}
+	case "github":
+		return h.verifyHex(r.Header.Get("X-Hub-Signature-256"), "sha256=", body)
+	case "slack":
+		ts := r.Header.Get("X-Slack-Request-Timestamp")
+		if err := h.checkTimestamp(ts, now); err != nil {
+			return err
+		}
+		payload := append([]byte("v0:"+ts+":"), body...)
+		return h.verifyHex(r.Header.Get("X-Slack-Signature"), "v0=", payload)
+	default:
+		payload := body
+		if h.TimestampHeader != "" {
+			ts := r.Header.Get(h.TimestampHeader)
+			if err := h.checkTimestamp(ts, now); err != nil {
+				return err
+			}
+			payload = append([]byte(ts+"."), body...)
+		}
+		return h.verifyHex(r.Header.Get(h.Header), "sha256=", payload)
+	}
+}
+
+// verifyHex compares a hex HMAC-SHA256 signature, with an optional prefix,
+// against payload under each configured secret.
+func (h *hmacAuth) verifyHex(header, prefix string, payload []byte) error {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return &authError{"missing_signature"}
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		return &authError{"bad_signature"}
+	}
+	for _, secret := range h.Secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		if hmac.Equal(sig, mac.Sum(nil)) {
+			return nil
+		}
+	}
+	return &authError{"bad_signature"}
+}
+
+// checkTimestamp rejects missing timestamps and ones outside the tolerance
+// window, which stops replay of captured requests.
+func (h *hmacAuth) checkTimestamp(raw string, now time.Time) error {
+	secs, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil {
+		return &authError{"missing_timestamp"}
+	}
+	skew := now.Sub(time.Unix(secs, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > h.tolerance {
+		return &authError{"stale_timestamp"}
+	}
+	return nil
+}
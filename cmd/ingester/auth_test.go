@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "s3cret"
+
+func sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHMACVerifiers(t *testing.T) {
+	body := readFixture(t, "pagerduty_incident_triggered.json")
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name string
+		auth hmacAuth
+		// headers signs body with secret and returns the request headers.
+		headers func(secret string) map[string]string
+	}{
+		{
+			name: "pagerduty",
+			auth: hmacAuth{Style: "pagerduty"},
+			headers: func(secret string) map[string]string {
+				// A rotated-out signature first, as PagerDuty sends during rotation.
+				return map[string]string{pagerDutySignatureHeader: "v1=" + sign("old", body) + ",v1=" + sign(secret, body)}
+			},
+		},
+		{
+			name: "github",
+			auth: hmacAuth{Style: "github"},
+			headers: func(secret string) map[string]string {
+				return map[string]string{"X-Hub-Signature-256": "sha256=" + sign(secret, body)}
+			},
+		},
+		{
+			name: "slack",
+			auth: hmacAuth{Style: "slack"},
+			headers: func(secret string) map[string]string {
+				payload := append([]byte("v0:"+ts+":"), body...)
+				return map[string]string{
+					"X-Slack-Request-Timestamp": ts,
+					"X-Slack-Signature":         "v0=" + sign(secret, payload),
+				}
+			},
+		},
+		{
+			name: "generic",
+			auth: hmacAuth{Style: "generic"},
+			headers: func(secret string) map[string]string {
+				return map[string]string{"X-Signature": "sha256=" + sign(secret, body)}
+			},
+		},
+		{
+			name: "generic with timestamp",
+			auth: hmacAuth{Style: "generic", Header: "X-Webhook-Signature", TimestampHeader: "X-Webhook-Timestamp"},
+			headers: func(secret string) map[string]string {
+				payload := append([]byte(ts+"."), body...)
+				return map[string]string{
+					"X-Webhook-Timestamp": ts,
+					"X-Webhook-Signature": sign(secret, payload),
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &routeAuth{HMAC: &tt.auth}
+			auth.HMAC.Secrets = []string{testSecret}
+			if err := auth.compile(); err != nil {
+				t.Fatal(err)
+			}
+			verify := func(headers map[string]string) error {
+				r, err := http.NewRequest(http.MethodPost, "/webhook/test", bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for k, v := range headers {
+					r.Header.Set(k, v)
+				}
+				return auth.verify(r, body, now)
+			}
+
+			if err := verify(tt.headers(testSecret)); err != nil {
+				t.Errorf("good signature rejected: %v", err)
+			}
+			assertRejected(t, verify(tt.headers("wrong")), "bad_signature")
+			assertRejected(t, verify(nil), "missing_")
+		})
+	}
+}
+
+func TestHMACRejectsStaleTimestamp(t *testing.T) {
+	body := []byte(`{"incident_id":"inc-1"}`)
+	auth := &routeAuth{HMAC: &hmacAuth{Style: "slack", Secrets: []string{testSecret}}}
+	if err := auth.compile(); err != nil {
+		t.Fatal(err)
+	}
+	signedAt := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(signedAt.Unix(), 10)
+	r, _ := http.NewRequest(http.MethodPost, "/webhook/slack", bytes.NewReader(body))
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+sign(testSecret, append([]byte("v0:"+ts+":"), body...)))
+
+	if err := auth.verify(r, body, signedAt.Add(time.Minute)); err != nil {
+		t.Errorf("signature within tolerance rejected: %v", err)
+	}
+	assertRejected(t, auth.verify(r, body, signedAt.Add(defaultSignatureTolerance+time.Second)), "stale_timestamp")
+}
+
+// assertRejected checks err is an authError whose reason starts with want.
+func assertRejected(t *testing.T, err error, want string) {
+	t.Helper()
+	var ae *authError
+	if !errors.As(err, &ae) {
+		t.Fatalf("got %v, want a %s rejection", err, want)
+	}
+	if !strings.HasPrefix(ae.reason, want) {
+		t.Errorf("rejection reason = %q, want %s", ae.reason, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/incidents"
+	"github.com/coretexos/coretex-incident-enricher/internal/schema"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const runRejected = "rejected"
+
+// batchResult is the outcome for one NDJSON line.
+type batchResult struct {
+	Line       int    `json:"line"`
+	IncidentID string `json:"incident_id,omitempty"`
+	runOutcome
+	Error      string             `json:"error,omitempty"`
+	Violations []schema.Violation `json:"violations,omitempty"`
+}
+
+// handleBatchWebhook accepts NDJSON with one IncidentInput per line and
+// submits each one. Lines fail independently; the response lists every
+// line's outcome. Without an Idempotency-Key each line gets a key derived
+// from its content, so resending a batch does not start duplicate runs.
+func handleBatchWebhook(w http.ResponseWriter, r *http.Request, starter *runStarter, defaultMode, defaultWebhook string, maxItems int) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	requestKey := idempotencyKeyFromRequest(r)
+
+	// Decode the whole batch before submitting anything so an oversized or
+	// truncated body is rejected without starting part of it.
+	type batchItem struct {
+		line  int
+		input types.IncidentInput
+		err   error
+	}
+	var items []batchItem
+	err := incidents.ReadNDJSON(bytes.NewReader(body), func(line int, input types.IncidentInput, err error) error {
+		if len(items) >= maxItems {
+			return fmt.Errorf("batch exceeds %d items", maxItems)
+		}
+		items = append(items, batchItem{line: line, input: input, err: err})
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "empty batch", http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batchResult, 0, len(items))
+	accepted, failed := 0, 0
+	for _, item := range items {
+		input, err := item.input, item.err
+		result := batchResult{Line: item.line, IncidentID: input.IncidentID}
+		if err == nil {
+			if input.Destination.Mode == "" {
+				input.Destination.Mode = defaultMode
+				input.Destination.SlackWebhookURL = defaultWebhook
+			}
+			input, err = starter.prepare(input)
+		}
+		if err == nil {
+			idempotency := incidents.IdempotencyKey("batch", input)
+			if requestKey != "" {
+				idempotency = fmt.Sprintf("%s:%d", requestKey, item.line)
+			}
+			result.runOutcome, err = starter.submit(r.Context(), input, idempotency)
+		}
+		if err != nil {
+			result.Status = runRejected
+			result.Error = err.Error()
+			var invalid *incidents.ValidationError
+			if errors.As(err, &invalid) {
+				result.Error = "invalid incident"
+				result.Violations = invalid.Violations
+			}
+			failed++
+		} else {
+			accepted++
+		}
+		results = append(results, result)
+	}
+	log.Printf("ingester: batch of %d incidents, %d accepted, %d failed", len(items), accepted, failed)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"accepted": accepted,
+		"failed":   failed,
+		"results":  results,
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+)
+
+// batchStarter starts runs at a gateway that rejects incidents whose id
+// ends in -rejected, and records the idempotency key of every StartRun.
+func batchStarter(t *testing.T) (*runStarter, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			IncidentID string `json:"incident_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&input)
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		mu.Unlock()
+		if strings.HasSuffix(input.IncidentID, "-rejected") {
+			http.Error(w, "workflow input rejected", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"run_id": "run-" + input.IncidentID})
+	}))
+	t.Cleanup(srv.Close)
+	starter := &runStarter{gw: gatewayclient.New(srv.URL, ""), workflowID: "enrich", updateWorkflowID: "update"}
+	return starter, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), keys...)
+	}
+}
+
+// batchResponse is the body handleBatchWebhook answers with.
+type batchResponse struct {
+	Accepted int           `json:"accepted"`
+	Failed   int           `json:"failed"`
+	Results  []batchResult `json:"results"`
+}
+
+func postBatch(t *testing.T, starter *runStarter, body, idempotencyKey string, maxItems int) (int, batchResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/webhook/batch", strings.NewReader(body))
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	rec := httptest.NewRecorder()
+	handleBatchWebhook(rec, req, starter, "artifact", "", maxItems)
+	var resp batchResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, resp
+}
+
+const batchBody = `{"incident_id":"inc-1","source":{"system":"prometheus"}}
+not json
+
+{"incident_id":"inc-2","severity":"sev9","source":{"system":"prometheus"}}
+{"incident_id":"inc-rejected","source":{"system":"prometheus"}}
+{"incident_id":"inc-3","severity":"P2","source":{"system":"Prometheus"}}
+`
+
+func TestBatchPartialFailures(t *testing.T) {
+	starter, keys := batchStarter(t)
+	code, resp := postBatch(t, starter, batchBody, "", 10)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if resp.Accepted != 2 || resp.Failed != 3 {
+		t.Errorf("accepted %d, failed %d; want 2 and 3", resp.Accepted, resp.Failed)
+	}
+	want := []struct {
+		line   int
+		status string
+		runID  string
+		err    string
+	}{
+		{line: 1, status: runStarted, runID: "run-inc-1"},
+		{line: 2, status: runRejected, err: "invalid json"},
+		{line: 4, status: runRejected, err: "invalid incident"},
+		{line: 5, status: runRejected, err: "workflow input rejected"},
+		{line: 6, status: runStarted, runID: "run-inc-3"},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(resp.Results), len(want), resp.Results)
+	}
+	for i, w := range want {
+		got := resp.Results[i]
+		if got.Line != w.line || got.Status != w.status || got.RunID != w.runID || !strings.Contains(got.Error, w.err) {
+			t.Errorf("result %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if v := resp.Results[2].Violations; len(v) != 1 || v[0].Path != "severity" {
+		t.Errorf("violations = %+v, want the severity enum", v)
+	}
+	if len(keys()) != 3 {
+		t.Errorf("gateway got %d StartRun calls, want one per valid line", len(keys()))
+	}
+}
+
+func TestBatchIdempotencyKeys(t *testing.T) {
+	starter, keys := batchStarter(t)
+	postBatch(t, starter, batchBody, "", 10)
+	postBatch(t, starter, batchBody, "", 10)
+	postBatch(t, starter, batchBody, "upload-7", 10)
+	got := keys()
+	if len(got) != 9 {
+		t.Fatalf("got %d StartRun calls, want 9", len(got))
+	}
+	// Resending a batch derives the same content keys; a request key
+	// is used per line instead.
+	for i := 0; i < 3; i++ {
+		if got[i] != got[i+3] || !strings.HasPrefix(got[i], "batch:inc-") {
+			t.Errorf("line key %d: %q then %q, want one stable content key", i, got[i], got[i+3])
+		}
+	}
+	if got[6] != "upload-7:1" || got[7] != "upload-7:5" || got[8] != "upload-7:6" {
+		t.Errorf("request-keyed lines = %v, want upload-7:<line>", got[6:])
+	}
+}
+
+func TestBatchRejectedWhole(t *testing.T) {
+	starter, keys := batchStarter(t)
+	tests := []struct {
+		name     string
+		body     string
+		maxItems int
+	}{
+		{"over max items", batchBody, 2},
+		{"empty", "\n\n", 10},
+		{"line too long", `{"incident_id":"` + strings.Repeat("x", 1<<20) + `"}`, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := postBatch(t, starter, tt.body, "", tt.maxItems); code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", code)
+			}
+		})
+	}
+	if len(keys()) != 0 {
+		t.Errorf("rejected batches started %d runs", len(keys()))
+	}
+}
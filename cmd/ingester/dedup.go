@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const (
+	dedupModeAttach = "attach"
+	dedupModeDrop   = "drop"
+)
+
+// deduper suppresses repeat webhooks for the same incident fingerprint
+// within a window and detects incidents that flap between trigger and
+// resolve. Either feature is off when its window is zero.
+type deduper struct {
+	mem           *store.Store
+	window        time.Duration
+	mode          string
+	fields        []string
+	flapWindow    time.Duration
+	flapThreshold int
+}
+
+// dedupRecord is the run started for a fingerprint inside the window. RunID
+// is empty while the request that claimed the fingerprint is starting it.
+type dedupRecord struct {
+	RunID     string `json:"run_id"`
+	FirstSeen string `json:"first_seen"`
+}
+
+// flapRecord tracks the last observed state and the times it changed.
+type flapRecord struct {
+	Last        string  `json:"last"`
+	Transitions []int64 `json:"transitions"`
+}
+
+func newDeduper(mem *store.Store, window time.Duration, mode string, fields []string, flapWindow time.Duration, flapThreshold int) (*deduper, error) {
+	if mode != dedupModeAttach && mode != dedupModeDrop {
+		return nil, fmt.Errorf("dedup mode %q must be %s or %s", mode, dedupModeAttach, dedupModeDrop)
+	}
+	for _, field := range fields {
+		if _, ok := fingerprintField(types.IncidentInput{}, field); !ok {
+			return nil, fmt.Errorf("unknown dedup field %q", field)
+		}
+	}
+	if flapThreshold < 2 {
+		flapThreshold = 2
+	}
+	return &deduper{
+		mem:           mem,
+		window:        window,
+		mode:          mode,
+		fields:        fields,
+		flapWindow:    flapWindow,
+		flapThreshold: flapThreshold,
+	}, nil
+}
+
+// fingerprint hashes the configured fields of input.
+func (d *deduper) fingerprint(input types.IncidentInput) string {
+	h := sha256.New()
+	for _, field := range d.fields {
+		value, _ := fingerprintField(input, field)
+		h.Write([]byte(field + "=" + value + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// dedupID is the key repeats of input are claimed under. Repeats are
+// matched per event type so a resolve is not mistaken for a repeat of the
+// trigger it follows, and updates also on their normalized content so each
+// change to an incident gets through while a redelivered update does not.
+func (d *deduper) dedupID(fingerprint string, input types.IncidentInput) string {
+	if input.EventType != types.EventUpdate {
+		return fingerprint + ":" + input.EventType
+	}
+	content, _ := json.Marshal(struct {
+		Title    string           `json:"title"`
+		Severity string           `json:"severity"`
+		Source   types.SourceInfo `json:"source"`
+		Raw      map[string]any   `json:"raw"`
+	}{input.Title, input.Severity, input.Source, input.Raw})
+	sum := sha256.Sum256(content)
+	return fingerprint + ":" + input.EventType + ":" + hex.EncodeToString(sum[:])[:16]
+}
+
+// fingerprintField resolves incident_id, title, severity, source.system,
+// source.url or raw.<path> (dot-separated) on input.
+func fingerprintField(input types.IncidentInput, field string) (string, bool) {
+	switch field {
+	case "incident_id":
+		return input.IncidentID, true
+	case "title":
+		return input.Title, true
+	case "severity":
+		return input.Severity, true
+	case "source.system":
+		return input.Source.System, true
+	case "source.url":
+		return input.Source.URL, true
+	}
+	path, ok := strings.CutPrefix(field, "raw.")
+	if !ok || path == "" {
+		return "", false
+	}
+	var cur any = input.Raw
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return "", true
+		}
+		cur = obj[key]
+	}
+	if cur == nil {
+		return "", true
+	}
+	return fmt.Sprint(cur), true
+}
+
+// claim atomically takes fingerprint for the window (SET NX). When another
+// request already holds it, claim reports a hit with that request's run ID,
+// which is empty if its run is still being started.
+func (d *deduper) claim(ctx context.Context, fingerprint string) (runID string, hit bool, err error) {
+	if d.window <= 0 {
+		return "", false, nil
+	}
+	key := dedupKey(fingerprint)
+	now := time.Now().UTC().Format(time.RFC3339)
+	claimed, err := d.mem.ClaimJSON(ctx, key, dedupRecord{FirstSeen: now}, d.window)
+	if err != nil || claimed {
+		return "", false, err
+	}
+	var rec dedupRecord
+	if _, err := d.mem.GetJSON(ctx, key, &rec); err != nil {
+		return "", true, err
+	}
+	return rec.RunID, true, nil
+}
+
+// remember records the run started under a fingerprint claimed by claim.
+func (d *deduper) remember(ctx context.Context, fingerprint, runID string) error {
+	if d.window <= 0 {
+		return nil
+	}
+	rec := dedupRecord{RunID: runID, FirstSeen: time.Now().UTC().Format(time.RFC3339)}
+	return d.mem.PutJSONTTL(ctx, dedupKey(fingerprint), rec, d.window)
+}
+
+// release gives up a claim whose run failed to start, so a retry of the
+// same event is not deduplicated against a run that does not exist.
+func (d *deduper) release(ctx context.Context, fingerprint string) error {
+	if d.window <= 0 {
+		return nil
+	}
+	return d.mem.DeleteKey(ctx, dedupKey(fingerprint))
+}
+
+// observe records a trigger or resolve for fingerprint and reports whether
+// the incident has changed state at least flapThreshold times within the
+// flap window. Updates do not change state.
+func (d *deduper) observe(ctx context.Context, fingerprint, eventType string, now time.Time) (bool, error) {
+	if d.flapWindow <= 0 || (eventType != types.EventTrigger && eventType != types.EventResolve) {
+		return false, nil
+	}
+	key := flapKey(fingerprint)
+	var rec flapRecord
+	if _, err := d.mem.GetJSON(ctx, key, &rec); err != nil {
+		return false, err
+	}
+	if rec.Last != "" && rec.Last != eventType {
+		rec.Transitions = append(rec.Transitions, now.UnixNano())
+	}
+	rec.Last = eventType
+	cutoff := now.Add(-d.flapWindow).UnixNano()
+	kept := rec.Transitions[:0]
+	for _, ts := range rec.Transitions {
+		if ts >= cutoff {
+			kept = append(kept, ts)
+		}
+	}
+	rec.Transitions = kept
+	if err := d.mem.PutJSONTTL(ctx, key, rec, d.flapWindow); err != nil {
+		return false, err
+	}
+	return len(rec.Transitions) >= d.flapThreshold, nil
+}
+
+func dedupKey(fingerprint string) string {
+	return "incident-enricher:ingest:dedup:" + fingerprint
+}
+
+func flapKey(fingerprint string) string {
+	return "incident-enricher:ingest:flap:" + fingerprint
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+func TestDedupID(t *testing.T) {
+	d, err := newDeduper(nil, 0, dedupModeAttach, []string{"source.system", "incident_id"}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := func(eventType string, change func(*types.IncidentInput)) string {
+		input := types.IncidentInput{
+			IncidentID: "inc-1",
+			EventType:  eventType,
+			Title:      "Disk full",
+			Severity:   "high",
+			Source:     types.SourceInfo{System: "pagerduty", URL: "https://example.com/inc-1"},
+			Raw:        map[string]any{"event": map[string]any{"event_type": "incident.acknowledged"}},
+		}
+		if change != nil {
+			change(&input)
+		}
+		return d.dedupID(d.fingerprint(input), input)
+	}
+
+	update := event(types.EventUpdate, nil)
+	if event(types.EventUpdate, nil) != update {
+		t.Error("a redelivered update got a new key")
+	}
+	if trigger := event(types.EventTrigger, nil); trigger == update || trigger == event(types.EventResolve, nil) {
+		t.Error("event types share a key")
+	}
+
+	changes := map[string]func(*types.IncidentInput){
+		"title":      func(in *types.IncidentInput) { in.Title = "Disk almost full" },
+		"severity":   func(in *types.IncidentInput) { in.Severity = "critical" },
+		"source url": func(in *types.IncidentInput) { in.Source.URL = "https://example.com/inc-1/log" },
+		"raw": func(in *types.IncidentInput) {
+			in.Raw["event"] = map[string]any{"event_type": "incident.priority_updated"}
+		},
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			if event(types.EventUpdate, change) == update {
+				t.Errorf("an update with a new %s was keyed as a repeat", name)
+			}
+			if event(types.EventTrigger, change) != event(types.EventTrigger, nil) {
+				t.Errorf("a trigger with a new %s escaped dedup", name)
+			}
+		})
+	}
+}
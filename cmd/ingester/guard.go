@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// guards applies the request body cap and the per-source and per-IP token
+// bucket limits in front of every webhook route. The per-source bucket is
+// keyed by the route routeOf names, never the raw path: every path without a
+// mapping shares the unknownRoute bucket, so varying the path neither adds
+// buckets nor escapes the limit.
+type guards struct {
+	maxBody        int64
+	perSource      *rateLimiter
+	perIP          *rateLimiter
+	trustForwarded bool
+}
+
+func (g *guards) wrap(routeOf func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if g.maxBody > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, g.maxBody)
+		}
+		now := time.Now()
+		route := routeOf(r)
+		if ok, wait := g.perSource.allow(route, now); !ok {
+			rateLimited.Inc("source", route)
+			tooManyRequests(w, wait)
+			return
+		}
+		if ok, wait := g.perIP.allow(g.clientIP(r), now); !ok {
+			rateLimited.Inc("ip", route)
+			tooManyRequests(w, wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// clientIP is the remote address, or the first X-Forwarded-For hop when the
+// ingester sits behind a trusted proxy.
+func (g *guards) clientIP(r *http.Request) string {
+	if g.trustForwarded {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
+
+// readBody reads the request body, answering 413 when it exceeds the
+// configured cap and 400 on other read errors.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("ingester: rejected %s %s from %s: body over %d bytes", r.Method, r.URL.Path, r.RemoteAddr, tooLarge.Limit)
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// rateLimiter is a set of token buckets keyed by source or client IP. A nil
+// limiter allows everything.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*tokenBucket{}}
+}
+
+// allow takes a token for key, or reports how long until one is available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, which bounds memory for
+// per-IP limits without changing any caller's allowance.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
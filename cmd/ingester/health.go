@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/store"
+)
+
+const readinessTimeout = 3 * time.Second
+
+// health serves /healthz and /readyz. Liveness only says the process is
+// serving; readiness also needs the gateway (and Redis, when the ingester
+// uses it) reachable, and turns false as soon as shutdown starts so load
+// balancers stop routing new webhooks while in-flight ones drain. With the
+// durable queue a gateway outage only delays runs, so readiness needs Redis
+// alone and the gateway check is informational.
+type health struct {
+	gw       *gatewayclient.Client
+	mem      *store.Store
+	queued   bool
+	draining atomic.Bool
+}
+
+func (h *health) handleLive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (h *health) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+	if h.draining.Load() {
+		checks["server"] = "draining"
+		ready = false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	checks["gateway"] = "ok"
+	if err := h.gw.Ping(ctx); err != nil {
+		checks["gateway"] = err.Error()
+		if !h.queued {
+			ready = false
+		}
+	}
+	if h.mem != nil {
+		checks["redis"] = "ok"
+		if err := h.mem.Ping(ctx); err != nil {
+			checks["redis"] = err.Error()
+			ready = false
+		}
+	}
+	status := "ready"
+	code := http.StatusOK
+	if !ready {
+		status = "not_ready"
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": status, "checks": checks})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+)
+
+func TestHandleReady(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer gateway.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	tests := []struct {
+		name        string
+		gatewayDown bool
+		redis       bool
+		redisDown   bool
+		queued      bool
+		draining    bool
+		want        int
+	}{
+		{name: "gateway only", want: http.StatusOK},
+		{name: "gateway down", gatewayDown: true, want: http.StatusServiceUnavailable},
+		{name: "redis down", redis: true, redisDown: true, want: http.StatusServiceUnavailable},
+		{name: "queued with gateway down", redis: true, queued: true, gatewayDown: true, want: http.StatusOK},
+		{name: "queued with redis down", redis: true, queued: true, redisDown: true, want: http.StatusServiceUnavailable},
+		{name: "draining", draining: true, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &health{gw: gatewayclient.New(gateway.URL, ""), queued: tt.queued}
+			if tt.gatewayDown {
+				h.gw = gatewayclient.New(down.URL, "")
+			}
+			if tt.redis {
+				mem, fake := newFakeStore()
+				fake.down = tt.redisDown
+				h.mem = mem
+			}
+			h.draining.Store(tt.draining)
+
+			rec := httptest.NewRecorder()
+			h.handleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			var body struct {
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if (body.Checks["gateway"] == "ok") == tt.gatewayDown {
+				t.Errorf("gateway check = %q; it is reported whether or not it gates readiness", body.Checks["gateway"])
+			}
+			if _, ok := body.Checks["redis"]; ok != tt.redis {
+				t.Errorf("checks = %v, want redis checked only when used", body.Checks)
+			}
+		})
+	}
+}
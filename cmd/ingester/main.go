@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	_ "expvar"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/coretexos/coretex-incident-enricher/internal/config"
 	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/metrics"
+	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/tracing"
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
 )
 
@@ -22,6 +30,10 @@ const defaultAddr = ":8088"
 
 func main() {
 	cfg := config.Load("ingester")
+	shutdownTracing, err := tracing.Init("ingester", cfg.TracesExporter)
+	if err != nil {
+		log.Fatalf("ingester: %v", err)
+	}
 	gw := gatewayclient.New(cfg.GatewayURL, cfg.APIKey)
 
 	addr := strings.TrimSpace(os.Getenv("INGESTER_ADDR"))
@@ -32,41 +44,211 @@ func main() {
 	if workflowID == "" {
 		workflowID = "incident-enricher.enrich"
 	}
+	updateWorkflowID := strings.TrimSpace(os.Getenv("INGESTER_UPDATE_WORKFLOW_ID"))
+	if updateWorkflowID == "" {
+		updateWorkflowID = "incident-enricher.update"
+	}
 	defaultMode := strings.TrimSpace(os.Getenv("DEFAULT_DESTINATION_MODE"))
 	if defaultMode == "" {
 		defaultMode = "artifact"
 	}
+	alertmanagerSplit := strings.EqualFold(strings.TrimSpace(os.Getenv("ALERTMANAGER_SPLIT_ALERTS")), "true")
+	mappings := map[string]*routeMapping{}
+	if path := strings.TrimSpace(os.Getenv("INGESTER_MAPPINGS_FILE")); path != "" {
+		loaded, err := loadMappings(path)
+		if err != nil {
+			log.Fatalf("ingester: %v", err)
+		}
+		mappings = loaded
+		log.Printf("ingester loaded %d webhook mappings from %s", len(mappings), path)
+	}
+	auths := map[string]*routeAuth{}
+	if path := strings.TrimSpace(os.Getenv("INGESTER_AUTH_FILE")); path != "" {
+		loaded, err := loadAuth(path)
+		if err != nil {
+			log.Fatalf("ingester: %v", err)
+		}
+		auths = loaded
+	}
+	if secret := strings.TrimSpace(os.Getenv("PAGERDUTY_WEBHOOK_SECRET")); secret != "" && auths["pagerduty"] == nil {
+		auth := &routeAuth{HMAC: &hmacAuth{Style: "pagerduty", Secrets: []string{secret}}}
+		if err := auth.compile(); err != nil {
+			log.Fatalf("ingester: pagerduty auth: %v", err)
+		}
+		auths["pagerduty"] = auth
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	starter := &runStarter{gw: gw, workflowID: workflowID, updateWorkflowID: updateWorkflowID}
+	var mem *store.Store
+	if cfg.DedupWindow > 0 || cfg.FlapWindow > 0 || cfg.IngestQueue {
+		var err error
+		mem, err = store.New(cfg.RedisURL, cfg.DataTTL)
+		if err != nil {
+			log.Fatalf("ingester: %v", err)
+		}
+	}
+	var groups *alertGroups
+	if mem != nil && !alertmanagerSplit {
+		groups = &alertGroups{mem: mem}
+	}
+	if cfg.DedupWindow > 0 || cfg.FlapWindow > 0 {
+		dedup, err := newDeduper(mem, cfg.DedupWindow, cfg.DedupMode, cfg.DedupFields, cfg.FlapWindow, cfg.FlapThreshold)
+		if err != nil {
+			log.Fatalf("ingester: %v", err)
+		}
+		starter.dedup = dedup
+	}
+	if cfg.IngestQueue {
+		queue, err := newIngestQueue(ctx, mem, starter, cfg.WorkerID, cfg.IngestBackoff, cfg.IngestMaxBackoff, cfg.IngestMaxAttempts)
+		if err != nil {
+			log.Fatalf("ingester: %v", err)
+		}
+		starter.queue = queue
+		go queue.run(ctx)
+	}
+	fixedRoute := func(name string) func(*http.Request) string {
+		return func(*http.Request) string { return name }
+	}
+	// sourceRoute names a mapped source, or "unknown" for any path without
+	// a mapping, so metrics, traces, rate limits and auth never key on
+	// arbitrary request paths.
+	sourceRoute := func(r *http.Request) string {
+		if _, ok := mappings[r.PathValue("source")]; ok {
+			return r.PathValue("source")
+		}
+		return unknownRoute
+	}
+
+	metrics.Serve(cfg.MetricsAddr, "ingester")
+	if cfg.DebugAddr != "" {
+		// Serves /debug/vars: Go runtime memstats and the command line.
+		go func() {
+			if err := http.ListenAndServe(cfg.DebugAddr, nil); err != nil {
+				log.Printf("ingester: debug listener: %v", err)
+			}
+		}()
+	}
+
+	g := &guards{
+		maxBody:        cfg.IngestMaxBodyBytes,
+		perSource:      newRateLimiter(cfg.IngestRateSource, cfg.IngestBurstSource),
+		perIP:          newRateLimiter(cfg.IngestRateIP, cfg.IngestBurstIP),
+		trustForwarded: cfg.IngestTrustXFF,
+	}
+	hc := &health{gw: gw, mem: mem, queued: starter.queue != nil}
+	// guarded applies body and rate limits before authentication, so
+	// rejected floods never reach signature checks; every outcome is counted
+	// and traced.
+	guarded := func(routeOf func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+		return traceWebhooks(routeOf, countWebhooks(routeOf, g.wrap(routeOf, withAuth(auths, routeOf, next))))
+	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook/mock", func(w http.ResponseWriter, r *http.Request) {
-		handleWebhook(w, r, gw, workflowID, defaultMode, cfg.SlackWebhookURL, "mock")
-	})
-	mux.HandleFunc("/webhook/pagerduty", func(w http.ResponseWriter, r *http.Request) {
-		handleWebhook(w, r, gw, workflowID, defaultMode, cfg.SlackWebhookURL, "pagerduty")
-	})
+	mux.HandleFunc("/healthz", hc.handleLive)
+	mux.HandleFunc("/readyz", hc.handleReady)
+	mux.HandleFunc("/webhook/mock", guarded(fixedRoute("mock"), func(w http.ResponseWriter, r *http.Request) {
+		handleWebhook(w, r, starter, defaultMode, cfg.SlackWebhookURL, "mock")
+	}))
+	mux.HandleFunc("/webhook/pagerduty", guarded(fixedRoute("pagerduty"), func(w http.ResponseWriter, r *http.Request) {
+		handlePagerDutyWebhook(w, r, starter, defaultMode, cfg.SlackWebhookURL)
+	}))
+	mux.HandleFunc("/webhook/alertmanager", guarded(fixedRoute("alertmanager"), func(w http.ResponseWriter, r *http.Request) {
+		handleAlertmanagerWebhook(w, r, starter, defaultMode, cfg.SlackWebhookURL, alertmanagerSplit, groups)
+	}))
+	// Batches share the rate limits but get their own body cap.
+	batchGuards := *g
+	batchGuards.maxBody = cfg.IngestBatchMaxBytes
+	mux.HandleFunc("/webhook/batch", traceWebhooks(fixedRoute("batch"), countWebhooks(fixedRoute("batch"), batchGuards.wrap(fixedRoute("batch"), withAuth(auths, fixedRoute("batch"), func(w http.ResponseWriter, r *http.Request) {
+		handleBatchWebhook(w, r, starter, defaultMode, cfg.SlackWebhookURL, cfg.IngestBatchMaxItems)
+	})))))
+	mux.HandleFunc("/webhook/{source}", guarded(sourceRoute, func(w http.ResponseWriter, r *http.Request) {
+		handleMappedWebhook(w, r, starter, defaultMode, cfg.SlackWebhookURL, mappings)
+	}))
+	if starter.queue != nil {
+		mux.HandleFunc("/ingest/{tracking_id}", guarded(fixedRoute("status"), func(w http.ResponseWriter, r *http.Request) {
+			handleIngestStatus(w, r, starter.queue)
+		}))
+	}
 
 	srv := &http.Server{
 		Addr:              addr,
 		Handler:           mux,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
-	log.Printf("ingester listening on %s", addr)
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		// Fail readiness first and keep serving while load balancers notice
+		// and stop sending webhooks, then let in-flight requests finish
+		// within the shutdown timeout.
+		hc.draining.Store(true)
+		log.Printf("ingester not ready, shutting down in %s", cfg.IngestShutdownDelay)
+		time.Sleep(cfg.IngestShutdownDelay)
+		log.Printf("ingester draining for up to %s", cfg.IngestShutdown)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.IngestShutdown)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("ingester: shutdown: %v", err)
+		}
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Printf("ingester: flush traces: %v", err)
+		}
+	}()
+	certFile := strings.TrimSpace(os.Getenv("INGESTER_TLS_CERT_FILE"))
+	keyFile := strings.TrimSpace(os.Getenv("INGESTER_TLS_KEY_FILE"))
+	if certFile == "" {
+		log.Printf("ingester listening on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+		<-drained
+		return
+	}
+	tlsConfig, err := serverTLSConfig(strings.TrimSpace(os.Getenv("INGESTER_TLS_CLIENT_CA_FILE")))
+	if err != nil {
+		log.Fatalf("ingester: %v", err)
+	}
+	srv.TLSConfig = tlsConfig
+	log.Printf("ingester listening on %s (tls)", addr)
+	if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	<-drained
+}
+
+// serverTLSConfig verifies client certificates against clientCAFile when one
+// is given. Certificates stay optional at the TLS layer so routes without a
+// client_cert rule keep working; routes with one reject unverified callers.
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client ca %s: no certificates found", clientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
 }
 
-func handleWebhook(w http.ResponseWriter, r *http.Request, gw *gatewayclient.Client, workflowID, defaultMode, defaultWebhook, system string) {
+func handleWebhook(w http.ResponseWriter, r *http.Request, starter *runStarter, defaultMode, defaultWebhook, system string) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "read body failed", http.StatusBadRequest)
+	body, ok := readBody(w, r)
+	if !ok {
 		return
 	}
-	defer r.Body.Close()
 
 	var raw map[string]any
 	if err := json.Unmarshal(body, &raw); err != nil {
@@ -74,6 +256,11 @@ func handleWebhook(w http.ResponseWriter, r *http.Request, gw *gatewayclient.Cli
 		return
 	}
 
+	if eventType := stringField(raw["event_type"]); eventType != "" && !validEventTypes[eventType] {
+		http.Error(w, "invalid event_type", http.StatusBadRequest)
+		return
+	}
+
 	input := types.IncidentInput{}
 	if err := json.Unmarshal(body, &input); err == nil {
 		if input.IncidentID != "" && input.Source.System != "" && input.Destination.Mode != "" {
@@ -87,15 +274,157 @@ func handleWebhook(w http.ResponseWriter, r *http.Request, gw *gatewayclient.Cli
 		input = buildIncidentInput(raw, defaultMode, defaultWebhook, system)
 	}
 
+	startRun(w, r, starter, input, idempotencyKeyFromRequest(r))
+}
+
+func handlePagerDutyWebhook(w http.ResponseWriter, r *http.Request, starter *runStarter, defaultMode, defaultWebhook string) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !isPagerDutyV3(raw) {
+		if eventType := stringField(raw["event_type"]); eventType != "" && !validEventTypes[eventType] {
+			http.Error(w, "invalid event_type", http.StatusBadRequest)
+			return
+		}
+		input := buildIncidentInput(raw, defaultMode, defaultWebhook, "pagerduty")
+		startRun(w, r, starter, input, idempotencyKeyFromRequest(r))
+		return
+	}
+
+	event, err := parsePagerDutyWebhook(body)
+	if err != nil {
+		http.Error(w, "invalid pagerduty webhook", http.StatusBadRequest)
+		return
+	}
+	if !pagerDutyEventTypes[event.EventType] {
+		// PagerDuty retries non-2xx deliveries, so acknowledge event types we
+		// do not act on instead of rejecting them.
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if event.Data.ID == "" {
+		http.Error(w, "missing incident id", http.StatusBadRequest)
+		return
+	}
+
 	idempotency := idempotencyKeyFromRequest(r)
-	runID, err := gw.StartRun(r.Context(), workflowID, toMap(input), idempotency)
+	if idempotency == "" && event.ID != "" {
+		idempotency = "pagerduty:" + event.ID
+	}
+	input := buildPagerDutyInput(event, raw, defaultMode, defaultWebhook)
+	startRun(w, r, starter, input, idempotency)
+}
+
+func handleAlertmanagerWebhook(w http.ResponseWriter, r *http.Request, starter *runStarter, defaultMode, defaultWebhook string, split bool, groups *alertGroups) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	payload, err := parseAlertmanagerWebhook(body)
 	if err != nil {
-		log.Printf("start run failed: %v", err)
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	incidents := buildAlertmanagerIncidents(payload, split, false, defaultMode, defaultWebhook)
+	if split || len(incidents) == 0 {
+		// A group with any firing alert is still firing, so only a fully
+		// resolved group (or, split, each resolved alert) is a resolve.
+		incidents = append(incidents, buildAlertmanagerIncidents(payload, split, true, defaultMode, defaultWebhook)...)
+	}
+	if len(incidents) == 0 {
+		w.WriteHeader(http.StatusAccepted)
 		return
 	}
+
+	// Validate the whole group first so a bad alert does not leave it
+	// half-submitted.
+	for _, incident := range incidents {
+		if _, err := starter.prepare(incident.Input); err != nil {
+			writeSubmitError(w, err)
+			return
+		}
+	}
+	if !split {
+		if err := groups.track(r.Context(), &incidents[0]); err != nil {
+			log.Printf("ingester: track alertmanager group %s: %v", incidents[0].Input.IncidentID, err)
+		}
+	}
+	runIDs := make([]string, 0, len(incidents))
+	outcomes := make([]runOutcome, 0, len(incidents))
+	for _, incident := range incidents {
+		outcome, err := starter.submit(r.Context(), incident.Input, incident.Idempotency)
+		if err != nil {
+			writeSubmitError(w, err)
+			return
+		}
+		if outcome.RunID != "" {
+			runIDs = append(runIDs, outcome.RunID)
+		}
+		outcomes = append(outcomes, outcome)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"run_id": runID})
+	_ = json.NewEncoder(w).Encode(map[string]any{"run_ids": runIDs, "runs": outcomes})
+}
+
+func handleMappedWebhook(w http.ResponseWriter, r *http.Request, starter *runStarter, defaultMode, defaultWebhook string, mappings map[string]*routeMapping) {
+	mapping, ok := mappings[r.PathValue("source")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	input, problems := mapping.apply(raw, defaultMode, defaultWebhook)
+	if len(problems) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string][]string{"errors": problems})
+		return
+	}
+	startRun(w, r, starter, input, idempotencyKeyFromRequest(r))
+}
+
+func startRun(w http.ResponseWriter, r *http.Request, starter *runStarter, input types.IncidentInput, idempotency string) {
+	outcome, err := starter.submit(r.Context(), input, idempotency)
+	if err != nil {
+		writeSubmitError(w, err)
+		return
+	}
+	writeOutcome(w, outcome)
+}
+
+var validEventTypes = map[string]bool{
+	types.EventTrigger: true,
+	types.EventUpdate:  true,
+	types.EventResolve: true,
 }
 
 func buildIncidentInput(raw map[string]any, defaultMode, defaultWebhook, system string) types.IncidentInput {
@@ -105,6 +434,7 @@ func buildIncidentInput(raw map[string]any, defaultMode, defaultWebhook, system
 	}
 	return types.IncidentInput{
 		IncidentID: incidentID,
+		EventType:  stringField(raw["event_type"]),
 		Title:      stringField(raw["title"]),
 		Severity:   stringField(raw["severity"]),
 		Source: types.SourceInfo{
@@ -153,10 +483,3 @@ func randomID(prefix string) string {
 	_, _ = rand.Read(buf)
 	return fmt.Sprintf("%s-%s", prefix, hex.EncodeToString(buf))
 }
-
-func toMap(input types.IncidentInput) map[string]any {
-	out := map[string]any{}
-	data, _ := json.Marshal(input)
-	_ = json.Unmarshal(data, &out)
-	return out
-}
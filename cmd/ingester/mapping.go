@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/incidents"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// mappingFile is the declarative webhook config loaded from
+// INGESTER_MAPPINGS_FILE; each route is served at /webhook/{source}.
+type mappingFile struct {
+	Routes map[string]*routeMapping `json:"routes"`
+}
+
+// routeMapping describes how to turn one source's payload into an
+// IncidentInput. Field expressions are JSONPath-style ("$.alert.message",
+// "$.tags[0]") and may list fallbacks separated by "||".
+type routeMapping struct {
+	System      string             `json:"system"`
+	IncidentID  string             `json:"incident_id"`
+	Title       string             `json:"title"`
+	Severity    string             `json:"severity"`
+	URL         string             `json:"url"`
+	EventType   string             `json:"event_type"`
+	SeverityMap map[string]string  `json:"severity_map"`
+	EventMap    map[string]string  `json:"event_type_map"`
+	Required    []string           `json:"required"`
+	Destination *types.Destination `json:"destination"`
+
+	exprs  map[string]string
+	fields map[string][]fieldPath
+}
+
+// fieldPath is one parsed expression: a sequence of object keys (string)
+// and array indexes (int).
+type fieldPath []any
+
+var (
+	sourceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	validSeverities   = map[string]bool{"low": true, "medium": true, "high": true, "critical": true}
+	mappedFields      = []string{"incident_id", "title", "severity", "url", "event_type"}
+)
+
+func loadMappings(path string) (map[string]*routeMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mappings: %w", err)
+	}
+	var file mappingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode mappings %s: %w", path, err)
+	}
+	for source, route := range file.Routes {
+		if route == nil {
+			return nil, fmt.Errorf("mapping %q: empty route", source)
+		}
+		if err := route.compile(source); err != nil {
+			return nil, fmt.Errorf("mapping %q: %w", source, err)
+		}
+	}
+	return file.Routes, nil
+}
+
+func (m *routeMapping) compile(source string) error {
+	if !sourceNamePattern.MatchString(source) {
+		return fmt.Errorf("route name must match %s", sourceNamePattern)
+	}
+	if m.System == "" {
+		m.System = source
+	}
+	if !sourceNamePattern.MatchString(m.System) {
+		return fmt.Errorf("system must match %s", sourceNamePattern)
+	}
+	m.exprs = map[string]string{
+		"incident_id": m.IncidentID,
+		"title":       m.Title,
+		"severity":    m.Severity,
+		"url":         m.URL,
+		"event_type":  m.EventType,
+	}
+	m.fields = map[string][]fieldPath{}
+	for name, expr := range m.exprs {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		for _, alt := range strings.Split(expr, "||") {
+			path, err := parseFieldPath(strings.TrimSpace(alt))
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			m.fields[name] = append(m.fields[name], path)
+		}
+	}
+	for _, name := range m.Required {
+		if _, ok := m.exprs[name]; !ok {
+			return fmt.Errorf("required field %q is not one of %s", name, strings.Join(mappedFields, ", "))
+		}
+	}
+	normalized := make(map[string]string, len(m.SeverityMap))
+	for from, to := range m.SeverityMap {
+		to = strings.ToLower(strings.TrimSpace(to))
+		if !validSeverities[to] {
+			return fmt.Errorf("severity_map %q -> %q: not a valid severity", from, to)
+		}
+		normalized[strings.ToLower(strings.TrimSpace(from))] = to
+	}
+	m.SeverityMap = normalized
+	events := make(map[string]string, len(m.EventMap))
+	for from, to := range m.EventMap {
+		to = strings.ToLower(strings.TrimSpace(to))
+		if !validEventTypes[to] {
+			return fmt.Errorf("event_type_map %q -> %q: not trigger, update or resolve", from, to)
+		}
+		events[strings.ToLower(strings.TrimSpace(from))] = to
+	}
+	m.EventMap = events
+	if m.Destination != nil && m.Destination.Mode != "" && m.Destination.Mode != "artifact" && m.Destination.Mode != "slack" {
+		return fmt.Errorf("destination mode %q must be artifact or slack", m.Destination.Mode)
+	}
+	return nil
+}
+
+// apply maps raw into an IncidentInput, returning every validation problem
+// rather than stopping at the first so callers can fix their payload at once.
+func (m *routeMapping) apply(raw map[string]any, defaultMode, defaultWebhook string) (types.IncidentInput, []string) {
+	values := map[string]string{}
+	for _, name := range mappedFields {
+		for _, path := range m.fields[name] {
+			if v := path.lookup(raw); v != "" {
+				values[name] = v
+				break
+			}
+		}
+	}
+
+	var problems []string
+	for _, name := range m.Required {
+		if values[name] == "" {
+			problems = append(problems, fmt.Sprintf("%s: no value at %s", name, m.exprs[name]))
+		}
+	}
+
+	severity := ""
+	if v := values["severity"]; v != "" {
+		key := strings.ToLower(v)
+		if mapped, ok := m.SeverityMap[key]; ok {
+			severity = mapped
+		} else if normalized := incidents.NormalizeSeverity(key); normalized != "" {
+			severity = normalized
+		} else {
+			problems = append(problems, fmt.Sprintf("severity: %q is not in severity_map", v))
+		}
+	}
+
+	eventType := types.EventTrigger
+	if v := values["event_type"]; v != "" {
+		key := strings.ToLower(v)
+		if mapped, ok := m.EventMap[key]; ok {
+			eventType = mapped
+		} else if validEventTypes[key] {
+			eventType = key
+		} else {
+			problems = append(problems, fmt.Sprintf("event_type: %q is not in event_type_map", v))
+		}
+	}
+
+	incidentID := values["incident_id"]
+	if incidentID == "" {
+		incidentID = randomID("inc")
+	}
+	dest := types.Destination{Mode: defaultMode, SlackWebhookURL: defaultWebhook}
+	if m.Destination != nil {
+		if m.Destination.Mode != "" {
+			dest.Mode = m.Destination.Mode
+		}
+		if m.Destination.SlackWebhookURL != "" {
+			dest.SlackWebhookURL = m.Destination.SlackWebhookURL
+		}
+	}
+	return types.IncidentInput{
+		IncidentID: incidentID,
+		EventType:  eventType,
+		Title:      values["title"],
+		Severity:   severity,
+		Source: types.SourceInfo{
+			System: m.System,
+			URL:    values["url"],
+		},
+		Raw:         raw,
+		Destination: dest,
+	}, problems
+}
+
+// parseFieldPath parses "$", ".key", "['key']" and "[index]" segments.
+func parseFieldPath(expr string) (fieldPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("expression %q must start with $", expr)
+	}
+	rest := expr[1:]
+	var path fieldPath
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("expression %q: empty key", expr)
+			}
+			path = append(path, rest[:end])
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("expression %q: unterminated ['", expr)
+			}
+			path = append(path, rest[2:end])
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("expression %q: unterminated [", expr)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("expression %q: invalid index %q", expr, rest[1:end])
+			}
+			path = append(path, idx)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("expression %q: unexpected %q", expr, rest)
+		}
+	}
+	return path, nil
+}
+
+// lookup resolves the path against decoded JSON and renders scalars as
+// strings; missing paths and non-scalar values yield "".
+func (p fieldPath) lookup(raw any) string {
+	cur := raw
+	for _, seg := range p {
+		switch key := seg.(type) {
+		case string:
+			obj, ok := cur.(map[string]any)
+			if !ok {
+				return ""
+			}
+			cur = obj[key]
+		case int:
+			arr, ok := cur.([]any)
+			if !ok || key >= len(arr) {
+				return ""
+			}
+			cur = arr[key]
+		}
+	}
+	switch v := cur.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+func TestOpsgenieMappingFixture(t *testing.T) {
+	mappings, err := loadMappings(filepath.Join("..", "..", "deploy", "ingester-mappings.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(readFixture(t, "opsgenie_webhook.json"), &raw); err != nil {
+		t.Fatal(err)
+	}
+	input, problems := mappings["opsgenie"].apply(raw, "artifact", "")
+	if len(problems) > 0 {
+		t.Fatalf("mapping problems: %v", problems)
+	}
+	input = mustPrepare(t, input)
+	if input.IncidentID != "70413a06-38d6-4c85-92b8-5ebc900d42e2" {
+		t.Errorf("incident_id = %q", input.IncidentID)
+	}
+	if input.EventType != types.EventTrigger {
+		t.Errorf("event_type = %q, want trigger for Create", input.EventType)
+	}
+	if input.Severity != "high" {
+		t.Errorf("severity = %q, want high for P2", input.Severity)
+	}
+	if input.Source.System != "opsgenie" || input.Source.URL == "" {
+		t.Errorf("source = %+v, want opsgenie with a URL", input.Source)
+	}
+}
+
+func TestParseFieldPath(t *testing.T) {
+	raw := map[string]any{
+		"alert": map[string]any{"tags": []any{"db", "prod"}, "count": 3.0, "ack": true, "odd key": "x"},
+	}
+	tests := []struct {
+		expr    string
+		want    string
+		wantErr bool
+	}{
+		{expr: "$.alert.tags[1]", want: "prod"},
+		{expr: "$.alert['odd key']", want: "x"},
+		{expr: "$.alert.count", want: "3"},
+		{expr: "$.alert.ack", want: "true"},
+		{expr: "$.alert.tags", want: ""},
+		{expr: "$.alert.tags[5]", want: ""},
+		{expr: "$.missing.key", want: ""},
+		{expr: "alert.tags", wantErr: true},
+		{expr: "$.alert..tags", wantErr: true},
+		{expr: "$.alert.tags[-1]", wantErr: true},
+		{expr: "$.alert['tags", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			path, err := parseFieldPath(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsed %v, want an error", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := path.lookup(raw); got != tt.want {
+				t.Errorf("lookup = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteMappingApply(t *testing.T) {
+	mapping := &routeMapping{
+		IncidentID:  "$.id || $.alerts[0].fingerprint",
+		Title:       "$.title",
+		Severity:    "$.level",
+		EventType:   "$.state",
+		SeverityMap: map[string]string{"Sev1": "critical"},
+		EventMap:    map[string]string{"OK": "resolve"},
+		Required:    []string{"incident_id", "title"},
+		Destination: &types.Destination{Mode: "slack"},
+	}
+	if err := mapping.compile("grafana-cloud"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		payload  string
+		want     types.IncidentInput
+		problems []string
+	}{
+		{
+			name:    "mapped values",
+			payload: `{"id":"g-1","title":"CPU high","level":"SEV1","state":"ok"}`,
+			want:    types.IncidentInput{IncidentID: "g-1", Title: "CPU high", Severity: "critical", EventType: types.EventResolve},
+		},
+		{
+			name:    "fallback path and severity aliases",
+			payload: `{"alerts":[{"fingerprint":"fp-9"}],"title":"Disk","level":"warning","state":"update"}`,
+			want:    types.IncidentInput{IncidentID: "fp-9", Title: "Disk", Severity: "medium", EventType: types.EventUpdate},
+		},
+		{
+			name:    "every problem at once",
+			payload: `{"level":"sev9","state":"paused"}`,
+			problems: []string{
+				"incident_id: no value at $.id || $.alerts[0].fingerprint",
+				"title: no value at $.title",
+				`severity: "sev9" is not in severity_map`,
+				`event_type: "paused" is not in event_type_map`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw map[string]any
+			if err := json.Unmarshal([]byte(tt.payload), &raw); err != nil {
+				t.Fatal(err)
+			}
+			input, problems := mapping.apply(raw, "artifact", "https://hooks.example/default")
+			if fmt.Sprint(problems) != fmt.Sprint(tt.problems) {
+				t.Fatalf("problems = %q, want %q", problems, tt.problems)
+			}
+			if len(problems) > 0 {
+				return
+			}
+			got := types.IncidentInput{IncidentID: input.IncidentID, Title: input.Title, Severity: input.Severity, EventType: input.EventType}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("input = %+v, want %+v", got, tt.want)
+			}
+			if input.Source.System != "grafana-cloud" {
+				t.Errorf("source.system = %q, want the route name", input.Source.System)
+			}
+			if input.Destination.Mode != "slack" || input.Destination.SlackWebhookURL != "https://hooks.example/default" {
+				t.Errorf("destination = %+v, want the route's mode with the default webhook", input.Destination)
+			}
+			mustPrepare(t, input)
+		})
+	}
+}
+
+func TestRouteMappingCompileErrors(t *testing.T) {
+	tests := map[string]*routeMapping{
+		"route name must match":          {},
+		"title: expression":              {Title: "title"},
+		"required field \"team\"":        {Required: []string{"team"}},
+		"not a valid severity":           {SeverityMap: map[string]string{"p1": "urgent"}},
+		"not trigger, update or resolve": {EventMap: map[string]string{"ack": "acknowledge"}},
+		"must be artifact or slack":      {Destination: &types.Destination{Mode: "email"}},
+	}
+	for want, mapping := range tests {
+		t.Run(want, func(t *testing.T) {
+			source := "ok-route"
+			if want == "route name must match" {
+				source = "Bad Route"
+			}
+			err := mapping.compile(source)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("err = %v, want %q", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/metrics"
+)
+
+var (
+	webhooksTotal  = metrics.NewCounter("ingester_webhooks_total", "Webhook requests, by source route and HTTP status code.", "source", "code")
+	dedupLookups   = metrics.NewCounter("ingester_dedup_lookups_total", "Dedup window lookups, by result (hit or miss).", "result")
+	runOutcomes    = metrics.NewCounter("ingester_incidents_total", "Submitted incidents, by outcome (started, attached, dropped, suppressed, queued).", "status")
+	authRejections = metrics.NewCounter("ingester_auth_rejections_total", "Webhook requests rejected by authentication, by route and reason.", "route", "reason")
+	rateLimited    = metrics.NewCounter("ingester_rate_limited_total", "Webhook requests rejected with 429, by limit (source or ip) and route.", "limit", "route")
+)
+
+// statusRecorder captures the status code a handler writes.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// unknownRoute is the route name for /webhook/ paths with no mapping.
+const unknownRoute = "unknown"
+
+// countWebhooks counts requests per route and status. routeOf must return a
+// fixed set of names (unknownRoute for paths that do not exist) so arbitrary
+// paths cannot grow the series set.
+func countWebhooks(routeOf func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(rec, r)
+		webhooksTotal.Inc(routeOf(r), strconv.Itoa(rec.code))
+	}
+}
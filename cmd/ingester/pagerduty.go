@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/incidents"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const pagerDutySignatureHeader = "X-PagerDuty-Signature"
+
+// pagerDutyWebhook is the v3 webhook envelope.
+type pagerDutyWebhook struct {
+	Event pagerDutyEvent `json:"event"`
+}
+
+type pagerDutyEvent struct {
+	ID        string            `json:"id"`
+	EventType string            `json:"event_type"`
+	Data      pagerDutyIncident `json:"data"`
+}
+
+type pagerDutyIncident struct {
+	ID       string        `json:"id"`
+	HTMLURL  string        `json:"html_url"`
+	Status   string        `json:"status"`
+	Title    string        `json:"title"`
+	Urgency  string        `json:"urgency"`
+	Priority *pagerDutyRef `json:"priority"`
+	Service  *pagerDutyRef `json:"service"`
+}
+
+type pagerDutyRef struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+}
+
+// pagerDutyEventTypes are the incident events the ingester understands.
+var pagerDutyEventTypes = map[string]bool{
+	"incident.triggered":    true,
+	"incident.acknowledged": true,
+	"incident.resolved":     true,
+}
+
+// pagerDutyEventType maps a webhook event type onto the incident lifecycle;
+// acknowledgements are updates.
+func pagerDutyEventType(eventType string) string {
+	switch eventType {
+	case "incident.resolved":
+		return types.EventResolve
+	case "incident.acknowledged":
+		return types.EventUpdate
+	}
+	return types.EventTrigger
+}
+
+// isPagerDutyV3 reports whether raw looks like a v3 webhook envelope rather
+// than the generic incident JSON the mock endpoint accepts.
+func isPagerDutyV3(raw map[string]any) bool {
+	event, ok := raw["event"].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = event["event_type"].(string)
+	return ok
+}
+
+func parsePagerDutyWebhook(body []byte) (pagerDutyEvent, error) {
+	var envelope pagerDutyWebhook
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return pagerDutyEvent{}, fmt.Errorf("decode pagerduty webhook: %w", err)
+	}
+	return envelope.Event, nil
+}
+
+func buildPagerDutyInput(event pagerDutyEvent, raw map[string]any, defaultMode, defaultWebhook string) types.IncidentInput {
+	data := event.Data
+	incidentRaw := map[string]any{}
+	if ev, ok := raw["event"].(map[string]any); ok {
+		incidentRaw = ev
+	}
+	incidentRaw["message"] = pagerDutyMessage(event)
+	return types.IncidentInput{
+		IncidentID: data.ID,
+		EventType:  pagerDutyEventType(event.EventType),
+		Title:      strings.TrimSpace(data.Title),
+		Severity:   pagerDutySeverity(data),
+		Source: types.SourceInfo{
+			System: "pagerduty",
+			URL:    data.HTMLURL,
+		},
+		Raw: incidentRaw,
+		Destination: types.Destination{
+			Mode:            defaultMode,
+			SlackWebhookURL: defaultWebhook,
+		},
+	}
+}
+
+// pagerDutySeverity maps the incident priority (P1..P5) when set, otherwise
+// the urgency, onto the workflow's severity enum.
+func pagerDutySeverity(data pagerDutyIncident) string {
+	if data.Priority != nil {
+		if severity := incidents.NormalizeSeverity(data.Priority.Summary); severity != "" {
+			return severity
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(data.Urgency)) {
+	case "high":
+		return "high"
+	case "low":
+		return "low"
+	}
+	return ""
+}
+
+func pagerDutyMessage(event pagerDutyEvent) string {
+	data := event.Data
+	parts := []string{strings.TrimSpace(data.Title)}
+	if data.Service != nil && data.Service.Summary != "" {
+		parts = append(parts, "service: "+data.Service.Summary)
+	}
+	if data.Urgency != "" {
+		parts = append(parts, "urgency: "+data.Urgency)
+	}
+	if data.Priority != nil && data.Priority.Summary != "" {
+		parts = append(parts, "priority: "+data.Priority.Summary)
+	}
+	if data.Status != "" {
+		parts = append(parts, "status: "+data.Status)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// verifyPagerDutySignature checks the v1 HMAC-SHA256 signatures PagerDuty
+// sends as "v1=<hex>[,v1=<hex>...]"; several are present during secret
+// rotation and any one matching is enough.
+func verifyPagerDutySignature(header string, body []byte, secret string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+	for _, part := range strings.Split(header, ",") {
+		version, sig, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || version != "v1" {
+			continue
+		}
+		decoded, err := hex.DecodeString(sig)
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(decoded, expected) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// readFixture returns a webhook payload from the repository's testdata.
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// mustPrepare runs input through the same normalization and schema check
+// the ingester applies before starting a run.
+func mustPrepare(t *testing.T, input types.IncidentInput) types.IncidentInput {
+	t.Helper()
+	prepared, err := (&runStarter{}).prepare(input)
+	if err != nil {
+		t.Fatalf("prepare %s: %v", input.IncidentID, err)
+	}
+	return prepared
+}
+
+func TestPagerDutyFixtures(t *testing.T) {
+	tests := []struct {
+		file      string
+		eventType string
+	}{
+		{"pagerduty_incident_triggered.json", types.EventTrigger},
+		{"pagerduty_incident_acknowledged.json", types.EventUpdate},
+		{"pagerduty_incident_resolved.json", types.EventResolve},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body := readFixture(t, tt.file)
+			var raw map[string]any
+			if err := json.Unmarshal(body, &raw); err != nil {
+				t.Fatal(err)
+			}
+			if !isPagerDutyV3(raw) {
+				t.Fatal("fixture not recognized as a v3 webhook")
+			}
+			event, err := parsePagerDutyWebhook(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pagerDutyEventTypes[event.EventType] {
+				t.Fatalf("event type %q not handled", event.EventType)
+			}
+			input := mustPrepare(t, buildPagerDutyInput(event, raw, "artifact", ""))
+			if input.IncidentID != "PGR0VU2" {
+				t.Errorf("incident_id = %q, want PGR0VU2", input.IncidentID)
+			}
+			if input.EventType != tt.eventType {
+				t.Errorf("event_type = %q, want %q", input.EventType, tt.eventType)
+			}
+			if input.Severity != "critical" {
+				t.Errorf("severity = %q, want critical (priority P1)", input.Severity)
+			}
+			if input.Source.System != "pagerduty" || input.Source.URL == "" {
+				t.Errorf("source = %+v, want pagerduty with a URL", input.Source)
+			}
+			if msg, _ := input.Raw["message"].(string); msg == "" {
+				t.Error("raw.message is empty")
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/tracing"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const (
+	queueStream = "incident-enricher:ingest:queue"
+	queueGroup  = "ingester"
+
+	runQueued = "queued"
+	runFailed = "failed"
+
+	// queueClaimIdle is how long a delivered entry may sit unacknowledged
+	// before another ingester takes it over; the owner refreshes its claim
+	// between retries so only crashed consumers lose entries.
+	queueClaimIdle = 2 * time.Minute
+	queueBlock     = 5 * time.Second
+	queueBatch     = 10
+)
+
+// ingestQueue durably buffers accepted incidents in a Redis stream so a
+// gateway outage delays runs instead of losing alerts. A background
+// dispatcher starts the runs with retry and records the outcome for the
+// status endpoint.
+type ingestQueue struct {
+	mem         *store.Store
+	starter     *runStarter
+	consumer    string
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+}
+
+// queuedIncident is one stream entry.
+type queuedIncident struct {
+	TrackingID  string              `json:"tracking_id"`
+	Input       types.IncidentInput `json:"input"`
+	Idempotency string              `json:"idempotency,omitempty"`
+	// Trace is the webhook's trace context, so the retried StartRun joins
+	// the same trace.
+	Trace map[string]string `json:"trace,omitempty"`
+	// ReceivedAt is when the webhook was accepted, for the ingest status.
+	ReceivedAt string `json:"received_at,omitempty"`
+}
+
+// ingestStatus is what GET /ingest/{tracking_id} reports.
+type ingestStatus struct {
+	TrackingID string `json:"tracking_id"`
+	IncidentID string `json:"incident_id"`
+	Status     string `json:"status"`
+	RunID      string `json:"run_id,omitempty"`
+	Attempts   int    `json:"attempts"`
+	LastError  string `json:"last_error,omitempty"`
+	ReceivedAt string `json:"received_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+func newIngestQueue(ctx context.Context, mem *store.Store, starter *runStarter, consumer string, backoff, maxBackoff time.Duration, maxAttempts int) (*ingestQueue, error) {
+	err := mem.Client().XGroupCreateMkStream(ctx, queueStream, queueGroup, "0").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("create ingest queue group: %w", err)
+	}
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	if maxBackoff < backoff {
+		maxBackoff = backoff
+	}
+	return &ingestQueue{
+		mem:         mem,
+		starter:     starter,
+		consumer:    consumer,
+		backoff:     backoff,
+		maxBackoff:  maxBackoff,
+		maxAttempts: maxAttempts,
+	}, nil
+}
+
+// enqueue stores the incident and returns its tracking id. Without an
+// idempotency key from the sender the tracking id is used, so a retry after
+// a lost gateway response does not start a second run.
+func (q *ingestQueue) enqueue(ctx context.Context, input types.IncidentInput, idempotency string) (string, error) {
+	trackingID := randomID("ing")
+	if idempotency == "" {
+		idempotency = "ingest:" + trackingID
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	traceCtx := map[string]string{}
+	tracing.Inject(ctx, propagation.MapCarrier(traceCtx))
+	entry, err := json.Marshal(queuedIncident{TrackingID: trackingID, Input: input, Idempotency: idempotency, Trace: traceCtx, ReceivedAt: now})
+	if err != nil {
+		return "", fmt.Errorf("marshal queued incident: %w", err)
+	}
+	err = q.mem.Client().XAdd(ctx, &redis.XAddArgs{
+		Stream: queueStream,
+		Values: map[string]any{"entry": string(entry)},
+	}).Err()
+	if err != nil {
+		return "", fmt.Errorf("enqueue incident: %w", err)
+	}
+	// The status is written only once the entry is in the stream, and with
+	// SET NX so it never overwrites a dispatcher that already picked the
+	// entry up. The incident is queued either way, so a failed write is
+	// logged rather than failing the webhook into a duplicate retry.
+	status := ingestStatus{
+		TrackingID: trackingID,
+		IncidentID: input.IncidentID,
+		Status:     runQueued,
+		ReceivedAt: now,
+		UpdatedAt:  now,
+	}
+	if _, err := q.mem.ClaimJSON(ctx, statusKey(trackingID), status, q.mem.TTL()); err != nil {
+		log.Printf("ingester: record ingest status %s: %v", trackingID, err)
+	}
+	return trackingID, nil
+}
+
+func (q *ingestQueue) status(ctx context.Context, trackingID string) (ingestStatus, bool, error) {
+	var status ingestStatus
+	hit, err := q.mem.GetJSON(ctx, statusKey(trackingID), &status)
+	return status, hit, err
+}
+
+// run dispatches queued incidents until ctx is cancelled. Entries left by
+// crashed consumers are taken over once idle for queueClaimIdle.
+func (q *ingestQueue) run(ctx context.Context) {
+	client := q.mem.Client()
+	for ctx.Err() == nil {
+		claimed, _, err := client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   queueStream,
+			Group:    queueGroup,
+			Consumer: q.consumer,
+			MinIdle:  queueClaimIdle,
+			Start:    "0",
+			Count:    queueBatch,
+		}).Result()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("ingester: claim queued incidents: %v", err)
+		}
+		for _, msg := range claimed {
+			q.dispatch(ctx, msg)
+		}
+
+		streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    queueGroup,
+			Consumer: q.consumer,
+			Streams:  []string{queueStream, ">"},
+			Count:    queueBatch,
+			Block:    queueBlock,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				log.Printf("ingester: read ingest queue: %v", err)
+				sleepCtx(ctx, q.backoff)
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				q.dispatch(ctx, msg)
+			}
+		}
+	}
+}
+
+// dispatch starts the run for one entry, retrying temporary failures with
+// exponential backoff. The entry is acknowledged once it has a final
+// outcome; on shutdown it stays pending for the next dispatcher.
+func (q *ingestQueue) dispatch(ctx context.Context, msg redis.XMessage) {
+	client := q.mem.Client()
+	raw, _ := msg.Values["entry"].(string)
+	var entry queuedIncident
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		log.Printf("ingester: drop malformed queue entry %s: %v", msg.ID, err)
+		q.ack(ctx, msg.ID)
+		return
+	}
+	ctx = tracing.Extract(ctx, propagation.MapCarrier(entry.Trace))
+
+	var status ingestStatus
+	if _, err := q.mem.GetJSON(ctx, statusKey(entry.TrackingID), &status); err != nil {
+		log.Printf("ingester: read ingest status %s: %v", entry.TrackingID, err)
+	}
+	status.TrackingID = entry.TrackingID
+	status.IncidentID = entry.Input.IncidentID
+	if status.ReceivedAt == "" {
+		status.ReceivedAt = entry.ReceivedAt
+	}
+
+	delay := q.backoff
+	for {
+		status.Attempts++
+		outcome, err := q.starter.start(ctx, entry.Input, entry.Idempotency)
+		if err == nil {
+			status.Status = outcome.Status
+			status.RunID = outcome.RunID
+			status.LastError = ""
+			break
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		status.LastError = err.Error()
+		if !temporary(err) || (q.maxAttempts > 0 && status.Attempts >= q.maxAttempts) {
+			log.Printf("ingester: giving up on %s after %d attempts: %v", entry.TrackingID, status.Attempts, err)
+			status.Status = runFailed
+			break
+		}
+		log.Printf("ingester: start run for %s failed (attempt %d), retrying in %s: %v", entry.TrackingID, status.Attempts, delay, err)
+		q.putStatus(ctx, status)
+		if !sleepCtx(ctx, delay) {
+			return
+		}
+		delay *= 2
+		if delay > q.maxBackoff {
+			delay = q.maxBackoff
+		}
+		// Refresh the claim so other ingesters do not take over an entry
+		// that is only waiting out a gateway outage.
+		_ = client.XClaimJustID(ctx, &redis.XClaimArgs{
+			Stream:   queueStream,
+			Group:    queueGroup,
+			Consumer: q.consumer,
+			Messages: []string{msg.ID},
+		}).Err()
+	}
+	q.putStatus(ctx, status)
+	q.ack(ctx, msg.ID)
+}
+
+func (q *ingestQueue) putStatus(ctx context.Context, status ingestStatus) {
+	status.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := q.mem.PutJSON(ctx, statusKey(status.TrackingID), status); err != nil {
+		log.Printf("ingester: record ingest status %s: %v", status.TrackingID, err)
+	}
+}
+
+func (q *ingestQueue) ack(ctx context.Context, id string) {
+	client := q.mem.Client()
+	if err := client.XAck(ctx, queueStream, queueGroup, id).Err(); err != nil {
+		log.Printf("ingester: ack queue entry %s: %v", id, err)
+		return
+	}
+	_ = client.XDel(ctx, queueStream, id).Err()
+}
+
+// temporary reports whether a StartRun failure is worth retrying: transport
+// errors and gateway 5xx/408/429 are, other gateway rejections are not.
+func temporary(err error) bool {
+	var statusErr *gatewayclient.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	return true
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func handleIngestStatus(w http.ResponseWriter, r *http.Request, queue *ingestQueue) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	status, ok, err := queue.status(r.Context(), r.PathValue("tracking_id"))
+	if err != nil {
+		http.Error(w, "status lookup failed", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+func statusKey(trackingID string) string {
+	return "incident-enricher:ingest:status:" + trackingID
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// fakeRedis answers the key and stream commands the ingest queue issues
+// from memory, through a client hook, so the dispatcher runs without a
+// Redis server. XAUTOCLAIM hands over reclaim once and XREADGROUP delivers
+// unread once; a read that finds nothing calls idle. Every ingest status
+// written is kept in statuses. While down every command fails.
+type fakeRedis struct {
+	mu        sync.Mutex
+	down      bool
+	keys      map[string]string
+	reclaim   []redis.XMessage
+	unread    []redis.XMessage
+	added     int
+	acked     []string
+	deleted   []string
+	refreshed []string
+	statuses  []ingestStatus
+	commands  []string
+	idle      func()
+}
+
+func (f *fakeRedis) DialHook(redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("fakeRedis does not dial")
+	}
+}
+
+func (f *fakeRedis) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(context.Context, []redis.Cmder) error { return errors.New("fakeRedis has no pipelines") }
+}
+
+func (f *fakeRedis) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		args := make([]string, len(cmd.Args()))
+		for i, arg := range cmd.Args() {
+			if b, ok := arg.([]byte); ok {
+				arg = string(b)
+			}
+			args[i] = fmt.Sprint(arg)
+		}
+		idle := f.process(cmd, args)
+		if idle && f.idle != nil {
+			f.idle()
+		}
+		return cmd.Err()
+	}
+}
+
+func (f *fakeRedis) process(cmd redis.Cmder, args []string) (idle bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+	if f.down {
+		cmd.SetErr(errors.New("connection refused"))
+		return false
+	}
+	switch c := cmd.(type) {
+	case *redis.StatusCmd: // SET, XGROUP CREATE
+		if args[0] == "set" {
+			f.set(args[1], args[2])
+		}
+		c.SetVal("OK")
+	case *redis.BoolCmd: // SET NX, SETNX
+		_, exists := f.keys[args[1]]
+		if !exists {
+			f.set(args[1], args[2])
+		}
+		c.SetVal(!exists)
+	case *redis.StringCmd: // GET, XADD
+		if args[0] == "xadd" {
+			f.added++
+			msg := redis.XMessage{ID: fmt.Sprintf("%d-0", f.added), Values: map[string]any{}}
+			for i := 3; i+1 < len(args); i += 2 {
+				msg.Values[args[i]] = args[i+1]
+			}
+			f.unread = append(f.unread, msg)
+			c.SetVal(msg.ID)
+			break
+		}
+		value, ok := f.keys[args[1]]
+		if !ok {
+			c.SetErr(redis.Nil)
+		}
+		c.SetVal(value)
+	case *redis.XAutoClaimCmd:
+		c.SetVal(f.reclaim, "0-0")
+		f.reclaim = nil
+	case *redis.XStreamSliceCmd: // XREADGROUP
+		if len(f.unread) == 0 {
+			c.SetErr(redis.Nil)
+			return true
+		}
+		c.SetVal([]redis.XStream{{Stream: queueStream, Messages: f.unread}})
+		f.unread = nil
+	case *redis.StringSliceCmd: // XCLAIM JUSTID
+		f.refreshed = append(f.refreshed, args[5:len(args)-1]...)
+	case *redis.IntCmd:
+		switch args[0] {
+		case "xack":
+			f.acked = append(f.acked, args[3:]...)
+		case "xdel":
+			f.deleted = append(f.deleted, args[2:]...)
+		}
+		c.SetVal(1)
+	default:
+		cmd.SetErr(fmt.Errorf("fakeRedis: unexpected %s", args[0]))
+	}
+	return false
+}
+
+func (f *fakeRedis) set(key, value string) {
+	f.keys[key] = value
+	if strings.HasPrefix(key, statusKey("")) {
+		var status ingestStatus
+		_ = json.Unmarshal([]byte(value), &status)
+		f.statuses = append(f.statuses, status)
+	}
+}
+
+func newFakeStore() (*store.Store, *fakeRedis) {
+	fake := &fakeRedis{keys: map[string]string{}}
+	client := redis.NewClient(&redis.Options{Addr: "fake:6379"})
+	client.AddHook(fake)
+	return store.NewFromClient(client, time.Hour), fake
+}
+
+// gatewayCall is one StartRun the test gateway received.
+type gatewayCall struct {
+	at          time.Time
+	idempotency string
+}
+
+// newTestQueue returns a queue on a fakeRedis whose runs are started by a
+// gateway answering StartRun with codes in turn, then 200.
+func newTestQueue(t *testing.T, backoff, maxBackoff time.Duration, maxAttempts int, codes ...int) (*ingestQueue, *fakeRedis, func() []gatewayCall) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []gatewayCall
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, gatewayCall{at: time.Now(), idempotency: r.Header.Get("Idempotency-Key")})
+		n := len(calls)
+		mu.Unlock()
+		if n <= len(codes) && codes[n-1] != http.StatusOK {
+			http.Error(w, "unavailable", codes[n-1])
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"run_id": fmt.Sprintf("run-%d", n)})
+	}))
+	t.Cleanup(srv.Close)
+
+	mem, fake := newFakeStore()
+	starter := &runStarter{gw: gatewayclient.New(srv.URL, ""), workflowID: "enrich", updateWorkflowID: "update"}
+	q, err := newIngestQueue(context.Background(), mem, starter, "ingester-1", backoff, maxBackoff, maxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, fake, func() []gatewayCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]gatewayCall(nil), calls...)
+	}
+}
+
+func queueMessage(t *testing.T, id string, entry queuedIncident) redis.XMessage {
+	t.Helper()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redis.XMessage{ID: id, Values: map[string]any{"entry": string(data)}}
+}
+
+var testEntry = queuedIncident{
+	TrackingID:  "ing-1",
+	Input:       types.IncidentInput{IncidentID: "inc-1", EventType: types.EventTrigger},
+	Idempotency: "ingest:ing-1",
+	ReceivedAt:  "2026-01-02T03:04:05Z",
+}
+
+func TestQueueDispatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		codes       []int
+		maxAttempts int
+		want        ingestStatus
+		// refreshes is how often the entry's claim was refreshed between
+		// retries.
+		refreshes int
+	}{
+		{
+			name: "started",
+			want: ingestStatus{Status: runStarted, RunID: "run-1", Attempts: 1},
+		},
+		{
+			name:      "temporary failures are retried",
+			codes:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+			want:      ingestStatus{Status: runStarted, RunID: "run-3", Attempts: 3},
+			refreshes: 2,
+		},
+		{
+			name:  "permanent failure",
+			codes: []int{http.StatusBadRequest},
+			want:  ingestStatus{Status: runFailed, Attempts: 1, LastError: "gateway POST /api/v1/workflows/enrich/runs: unavailable"},
+		},
+		{
+			name:        "max attempts",
+			codes:       []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			maxAttempts: 2,
+			want:        ingestStatus{Status: runFailed, Attempts: 2, LastError: "gateway POST /api/v1/workflows/enrich/runs: unavailable"},
+			refreshes:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, fake, calls := newTestQueue(t, time.Millisecond, time.Millisecond, tt.maxAttempts, tt.codes...)
+			q.dispatch(context.Background(), queueMessage(t, "1-0", testEntry))
+
+			final := fake.statuses[len(fake.statuses)-1]
+			tt.want.TrackingID, tt.want.IncidentID, tt.want.ReceivedAt = "ing-1", "inc-1", testEntry.ReceivedAt
+			final.UpdatedAt = ""
+			if final != tt.want {
+				t.Errorf("final status = %+v, want %+v", final, tt.want)
+			}
+			// Each failed attempt that is retried is recorded before the
+			// backoff, so the status endpoint shows the outage.
+			if retries := fake.statuses[:len(fake.statuses)-1]; len(retries) != len(fake.refreshed) {
+				t.Errorf("%d interim statuses for %d retries", len(retries), len(fake.refreshed))
+			} else {
+				for i, status := range retries {
+					if status.Attempts != i+1 || status.LastError == "" || status.Status != "" {
+						t.Errorf("interim status %d = %+v", i, status)
+					}
+				}
+			}
+			if len(fake.refreshed) != tt.refreshes {
+				t.Errorf("claim refreshed %d times, want %d", len(fake.refreshed), tt.refreshes)
+			}
+			if fmt.Sprint(fake.acked, fake.deleted) != "[1-0] [1-0]" {
+				t.Errorf("acked %v, deleted %v; want the entry acknowledged and removed", fake.acked, fake.deleted)
+			}
+			for _, call := range calls() {
+				if call.idempotency != "ingest:ing-1" {
+					t.Errorf("StartRun idempotency key = %q, want the entry's", call.idempotency)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueDispatchBackoff(t *testing.T) {
+	unavailable := http.StatusServiceUnavailable
+	q, _, calls := newTestQueue(t, 20*time.Millisecond, 30*time.Millisecond, 0, unavailable, unavailable, unavailable)
+	q.dispatch(context.Background(), queueMessage(t, "1-0", testEntry))
+
+	got := calls()
+	if len(got) != 4 {
+		t.Fatalf("got %d StartRun calls, want 4", len(got))
+	}
+	// 20ms, doubled to 40ms but capped at 30ms, then 30ms again.
+	for i, want := range []time.Duration{20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond} {
+		gap := got[i+1].at.Sub(got[i].at)
+		if gap < want || gap >= want+25*time.Millisecond {
+			t.Errorf("retry %d after %s, want %s", i+1, gap, want)
+		}
+	}
+}
+
+func TestQueueDispatchShutdownLeavesEntryPending(t *testing.T) {
+	q, fake, _ := newTestQueue(t, time.Minute, time.Minute, 0, http.StatusServiceUnavailable)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.dispatch(ctx, queueMessage(t, "1-0", testEntry))
+		close(done)
+	}()
+	// Shut down once the failed attempt is recorded and dispatch is
+	// waiting out its backoff.
+	for {
+		fake.mu.Lock()
+		written := len(fake.statuses)
+		fake.mu.Unlock()
+		if written > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch kept waiting out its backoff after shutdown")
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.acked) != 0 {
+		t.Errorf("acked %v on shutdown; the entry must stay pending for another dispatcher", fake.acked)
+	}
+	if len(fake.statuses) != 1 || fake.statuses[0].Attempts != 1 {
+		t.Errorf("statuses = %+v, want the failed first attempt", fake.statuses)
+	}
+}
+
+func TestQueueDispatchMalformedEntry(t *testing.T) {
+	q, fake, calls := newTestQueue(t, time.Millisecond, time.Millisecond, 0)
+	q.dispatch(context.Background(), redis.XMessage{ID: "1-0", Values: map[string]any{"entry": "{"}})
+	if len(calls()) != 0 || len(fake.statuses) != 0 {
+		t.Errorf("malformed entry started %d runs and wrote %d statuses", len(calls()), len(fake.statuses))
+	}
+	if fmt.Sprint(fake.acked) != "[1-0]" {
+		t.Errorf("acked %v, want the malformed entry dropped", fake.acked)
+	}
+}
+
+func TestQueueRunReclaimsThenReads(t *testing.T) {
+	q, fake, calls := newTestQueue(t, time.Millisecond, time.Millisecond, 0)
+	stale := testEntry
+	stale.TrackingID, stale.Idempotency = "ing-stale", "ingest:ing-stale"
+	fake.reclaim = []redis.XMessage{queueMessage(t, "1-0", stale)}
+	fake.unread = []redis.XMessage{queueMessage(t, "2-0", testEntry)}
+	ctx, cancel := context.WithCancel(context.Background())
+	fake.idle = cancel
+	q.run(ctx)
+
+	if fmt.Sprint(fake.acked) != "[1-0 2-0]" {
+		t.Errorf("acked %v, want the reclaimed entry, then the new one", fake.acked)
+	}
+	got := calls()
+	if len(got) != 2 || got[0].idempotency != "ingest:ing-stale" || got[1].idempotency != "ingest:ing-1" {
+		t.Errorf("StartRun calls = %+v", got)
+	}
+	wantClaim := fmt.Sprintf("xautoclaim %s %s ingester-1 %d 0 count %d", queueStream, queueGroup, queueClaimIdle.Milliseconds(), queueBatch)
+	if fake.commands[1] != wantClaim {
+		t.Errorf("first claim = %q, want %q", fake.commands[1], wantClaim)
+	}
+}
+
+func TestQueueEnqueueThenDispatch(t *testing.T) {
+	q, fake, calls := newTestQueue(t, time.Millisecond, time.Millisecond, 0)
+	input := types.IncidentInput{IncidentID: "inc-2", EventType: types.EventTrigger}
+	trackingID, err := q.enqueue(context.Background(), input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := fake.statuses[0]
+	if queued.Status != runQueued || queued.TrackingID != trackingID || queued.ReceivedAt == "" {
+		t.Errorf("queued status = %+v", queued)
+	}
+	// The queued status is only created (SET NX), never overwritten.
+	if claim := fake.commands[len(fake.commands)-1]; !strings.HasPrefix(claim, "set "+statusKey(trackingID)) || !strings.HasSuffix(claim, " nx") {
+		t.Errorf("status written with %q, want SET NX", claim)
+	}
+	if _, err := q.enqueue(context.Background(), input, "sender-key"); err != nil {
+		t.Fatal(err)
+	}
+
+	q.dispatch(context.Background(), fake.unread[0])
+	q.dispatch(context.Background(), fake.unread[1])
+	got := calls()
+	if len(got) != 2 || got[0].idempotency != "ingest:"+trackingID || got[1].idempotency != "sender-key" {
+		t.Errorf("StartRun idempotency keys = %+v, want the tracking id without a sender key", got)
+	}
+	status, ok, err := q.status(context.Background(), trackingID)
+	if err != nil || !ok {
+		t.Fatalf("status: ok=%v err=%v", ok, err)
+	}
+	if status.Status != runStarted || status.RunID != "run-1" || status.ReceivedAt != queued.ReceivedAt {
+		t.Errorf("status = %+v, want started keeping the queued received_at", status)
+	}
+}
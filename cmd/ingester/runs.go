@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/incidents"
+	"github.com/coretexos/coretex-incident-enricher/internal/tracing"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const (
+	runStarted    = "started"
+	runAttached   = "attached"
+	runDropped    = "dropped"
+	runSuppressed = "suppressed"
+)
+
+// runStarter starts workflow runs for incidents, applying deduplication and
+// flap suppression when configured. Triggers start the enrich workflow,
+// updates and resolves the lighter update workflow. With a queue, webhooks
+// only enqueue and the queue's dispatcher calls start.
+type runStarter struct {
+	gw               *gatewayclient.Client
+	workflowID       string
+	updateWorkflowID string
+	dedup            *deduper
+	queue            *ingestQueue
+}
+
+// runOutcome is what happened to one incident; RunID is empty when the
+// incident was queued, dropped or suppressed.
+type runOutcome struct {
+	RunID      string `json:"run_id,omitempty"`
+	TrackingID string `json:"tracking_id,omitempty"`
+	Status     string `json:"status"`
+	TraceID    string `json:"trace_id,omitempty"`
+}
+
+// prepare normalizes input and validates it against the IncidentInput
+// schema, so bad incidents are rejected here instead of failing at the
+// gateway.
+func (s *runStarter) prepare(input types.IncidentInput) (types.IncidentInput, error) {
+	incidents.Normalize(&input)
+	return input, incidents.ValidateInput(input)
+}
+
+// submit enqueues input when the durable queue is enabled and starts the
+// run directly otherwise.
+func (s *runStarter) submit(ctx context.Context, input types.IncidentInput, idempotency string) (runOutcome, error) {
+	input, err := s.prepare(input)
+	if err != nil {
+		return runOutcome{}, err
+	}
+	if s.queue == nil {
+		outcome, err := s.start(ctx, input, idempotency)
+		if err == nil {
+			runOutcomes.Inc(outcome.Status)
+		}
+		return outcome, err
+	}
+	trackingID, err := s.queue.enqueue(ctx, input, idempotency)
+	if err != nil {
+		return runOutcome{}, err
+	}
+	runOutcomes.Inc(runQueued)
+	return runOutcome{TrackingID: trackingID, Status: runQueued}, nil
+}
+
+// start starts a run for input unless it repeats an event seen within the
+// dedup window or the incident is flapping between trigger and resolve.
+func (s *runStarter) start(ctx context.Context, input types.IncidentInput, idempotency string) (runOutcome, error) {
+	if input.EventType == "" {
+		input.EventType = types.EventTrigger
+	}
+	if s.dedup == nil {
+		return s.startRun(ctx, input, idempotency)
+	}
+
+	fingerprint := s.dedup.fingerprint(input)
+	flapping, err := s.dedup.observe(ctx, fingerprint, input.EventType, time.Now())
+	if err != nil {
+		log.Printf("ingester: flap check for %s: %v", input.IncidentID, err)
+	}
+	if flapping && input.EventType != types.EventUpdate {
+		log.Printf("ingester: suppressed flapping incident %s (%s)", input.IncidentID, input.EventType)
+		return runOutcome{Status: runSuppressed}, nil
+	}
+
+	// The fingerprint is claimed before the run starts so concurrent
+	// repeats cannot both start one.
+	dedupID := s.dedup.dedupID(fingerprint, input)
+	runID, hit, err := s.dedup.claim(ctx, dedupID)
+	if err != nil {
+		log.Printf("ingester: dedup claim for %s: %v", input.IncidentID, err)
+	}
+	if s.dedup.window > 0 {
+		if hit {
+			dedupLookups.Inc("hit")
+		} else {
+			dedupLookups.Inc("miss")
+		}
+	}
+	if hit {
+		if s.dedup.mode == dedupModeDrop {
+			return runOutcome{Status: runDropped}, nil
+		}
+		return runOutcome{RunID: runID, Status: runAttached}, nil
+	}
+
+	outcome, err := s.startRun(ctx, input, idempotency)
+	if err != nil {
+		if err := s.dedup.release(context.WithoutCancel(ctx), dedupID); err != nil {
+			log.Printf("ingester: dedup release for %s: %v", input.IncidentID, err)
+		}
+		return runOutcome{}, err
+	}
+	if err := s.dedup.remember(ctx, dedupID, outcome.RunID); err != nil {
+		log.Printf("ingester: dedup record for %s: %v", input.IncidentID, err)
+	}
+	return outcome, nil
+}
+
+func (s *runStarter) startRun(ctx context.Context, input types.IncidentInput, idempotency string) (runOutcome, error) {
+	workflowID := s.workflowID
+	if input.EventType != types.EventTrigger {
+		workflowID = s.updateWorkflowID
+	}
+	payload := incidents.ToMap(input)
+	// The trace context rides in the run input so every step's job can
+	// continue the webhook's trace; it is added here, after dedup and
+	// idempotency keys were derived from the incident alone.
+	carrier := propagation.MapCarrier{}
+	tracing.Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		payload[tracing.InputField] = map[string]string(carrier)
+	}
+	runID, err := s.gw.StartRun(ctx, workflowID, payload, idempotency)
+	if err != nil {
+		return runOutcome{}, err
+	}
+	return runOutcome{RunID: runID, Status: runStarted, TraceID: tracing.TraceID(ctx)}, nil
+}
+
+// writeSubmitError answers 422 with the schema violations for invalid
+// incidents and 502 for gateway or queue failures.
+func writeSubmitError(w http.ResponseWriter, err error) {
+	var invalid *incidents.ValidationError
+	if errors.As(err, &invalid) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "invalid incident", "violations": invalid.Violations})
+		return
+	}
+	log.Printf("start run failed: %v", err)
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+func writeOutcome(w http.ResponseWriter, outcome runOutcome) {
+	w.Header().Set("Content-Type", "application/json")
+	if outcome.RunID == "" {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = json.NewEncoder(w).Encode(outcome)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/schema"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+func TestWriteSubmitErrorInvalidIncident(t *testing.T) {
+	starter := &runStarter{}
+	_, err := starter.submit(context.Background(), types.IncidentInput{
+		IncidentID:  " inc-1 ",
+		Severity:    "urgent",
+		Source:      types.SourceInfo{System: "Prometheus"},
+		Destination: types.Destination{Mode: "email"},
+	}, "")
+	rec := httptest.NewRecorder()
+	writeSubmitError(rec, err)
+
+	if rec.Code != http.StatusUnprocessableEntity || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("got %d %s, want 422 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var body struct {
+		Error      string             `json:"error"`
+		Violations []schema.Violation `json:"violations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	// The system and id were normalized before validation; the unknown
+	// severity and mode were not.
+	want := []schema.Violation{
+		{Path: "destination.mode", Message: "must be one of [artifact, slack]"},
+		{Path: "severity", Message: "must be one of [low, medium, high, critical]"},
+	}
+	if body.Error != "invalid incident" || len(body.Violations) != len(want) {
+		t.Fatalf("body = %s", rec.Body)
+	}
+	for i := range want {
+		if body.Violations[i] != want[i] {
+			t.Errorf("violation %d = %+v, want %+v", i, body.Violations[i], want[i])
+		}
+	}
+}
+
+func TestWriteSubmitErrorGateway(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeSubmitError(rec, errors.New("gateway POST /api/v1/workflows/enrich/runs: unavailable"))
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "unavailable") {
+		t.Errorf("got %d %q, want 502 with the gateway error", rec.Code, rec.Body)
+	}
+}
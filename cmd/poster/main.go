@@ -6,22 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
-	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
-	"github.com/coretexos/cap/v2/sdk/go/worker"
 	"github.com/coretexos/coretex-incident-enricher/internal/artifacts"
-	"github.com/coretexos/coretex-incident-enricher/internal/config"
-	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
 	"github.com/coretexos/coretex-incident-enricher/internal/policyconstraints"
+	"github.com/coretexos/coretex-incident-enricher/internal/runtime"
 	"github.com/coretexos/coretex-incident-enricher/internal/slack"
-	"github.com/coretexos/coretex-incident-enricher/internal/store"
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
-	"github.com/nats-io/nats.go"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -32,39 +25,52 @@ type posterInput struct {
 }
 
 func main() {
-	cfg := config.Load("poster")
-
-	nc, err := nats.Connect(cfg.NATSURL)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer nc.Close()
-
-	mem, err := store.New(cfg.RedisURL, cfg.DataTTL)
+	rt, err := runtime.New("poster")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer rt.Close()
+	cfg, mem, gw := rt.Config, rt.Store, rt.Gateway
 
-	gw := gatewayclient.New(cfg.GatewayURL, cfg.APIKey)
-
-	handler := func(ctx context.Context, req *agentv1.JobRequest) (*agentv1.JobResult, error) {
-		start := time.Now()
-		ctxPtr := req.GetContextPtr()
-		if ctxPtr == "" && req.Env != nil {
-			ctxPtr = req.Env["context_ptr"]
+	handler := func(ctx context.Context, input posterInput) (types.PostResult, []string, error) {
+		req := runtime.Job(ctx)
+		if strings.TrimSpace(input.Incident.IncidentID) == "" {
+			return types.PostResult{}, nil, failure.Errorf(failure.Validation, "missing incident_id")
 		}
-		var input posterInput
-		if err := mem.GetContextJSON(ctx, ctxPtr, &input); err != nil {
-			return nil, err
+		eventType := input.Incident.EventType
+		if eventType == "" {
+			eventType = types.EventTrigger
 		}
-		if strings.TrimSpace(input.Incident.IncidentID) == "" {
-			return nil, errors.New("missing incident_id")
+		// The trigger's post is cached under the incident id and is what
+		// updates and resolves thread onto; follow-ups are cached per job so
+		// retries do not repost. A follow-up that arrives before the
+		// trigger's post is kept under orphanKey, never originalKey, so the
+		// trigger still posts its summary when it gets here.
+		originalKey := "incident-enricher:posted:" + input.Incident.IncidentID
+		orphanKey := originalKey + ":orphan"
+		cacheKey := originalKey
+		if eventType != types.EventTrigger {
+			cacheKey = originalKey + ":" + eventType + ":" + req.GetJobId()
 		}
-		cacheKey := "incident-enricher:posted:" + input.Incident.IncidentID
 		if cached, ok, err := getCachedPost(ctx, mem.Client(), cacheKey); err != nil {
-			return nil, err
-		} else if ok {
-			return buildResult(ctx, mem, cfg, req, cached, start)
+			return types.PostResult{}, nil, err
+		} else if ok && (cached.EventType == "" || cached.EventType == eventType) {
+			// Entries written under the trigger key by older versions may be
+			// follow-ups; the trigger posts over those.
+			return cached, postArtifacts(cached), nil
+		}
+		var original *types.PostResult
+		if eventType != types.EventTrigger {
+			for _, key := range []string{originalKey, orphanKey} {
+				prev, ok, err := getCachedPost(ctx, mem.Client(), key)
+				if err != nil {
+					return types.PostResult{}, nil, err
+				}
+				if ok {
+					original = &prev
+					break
+				}
+			}
 		}
 
 		mode := strings.ToLower(strings.TrimSpace(input.Incident.Destination.Mode))
@@ -73,90 +79,154 @@ func main() {
 		}
 		result := types.PostResult{
 			IncidentID: input.Incident.IncidentID,
+			EventType:  eventType,
 			Mode:       mode,
 			PostedAt:   time.Now().UTC().Format(time.RFC3339),
 		}
 
+		message := strings.TrimSpace(input.Summary.SummaryMarkdown)
+		if eventType != types.EventTrigger {
+			message = followUpMessage(input.Incident, original)
+		} else if message == "" {
+			message = fmt.Sprintf("Incident %s summary ready", input.Incident.IncidentID)
+		}
+
+		// remember caches the post so retries return it instead of posting
+		// again. A follow-up with no original to thread onto becomes the
+		// post later follow-ups thread onto until the trigger's post exists.
+		remember := func(ctx context.Context) error {
+			if original == nil && eventType != types.EventTrigger {
+				if err := storeCachedPost(ctx, mem.Client(), orphanKey, result, cfg.DataTTL); err != nil {
+					return err
+				}
+			}
+			return storeCachedPost(ctx, mem.Client(), cacheKey, result, cfg.DataTTL)
+		}
+
 		maxBytes := policyconstraints.MaxArtifactBytes(req.Env)
 		switch mode {
 		case "slack":
-			webhook := strings.TrimSpace(input.Incident.Destination.SlackWebhookURL)
-			if webhook == "" {
-				webhook = cfg.SlackWebhookURL
-			}
-			if webhook == "" {
-				return nil, errors.New("slack webhook url missing")
-			}
 			constraints, err := policyconstraints.Parse(req.Env)
 			if err != nil {
-				return nil, err
+				return types.PostResult{}, nil, failure.New(failure.Validation, fmt.Errorf("parse policy constraints: %w", err))
+			}
+			target := slack.APIURL
+			webhook := ""
+			if cfg.SlackBotToken == "" {
+				webhook = strings.TrimSpace(input.Incident.Destination.SlackWebhookURL)
+				if webhook == "" {
+					webhook = cfg.SlackWebhookURL
+				}
+				if webhook == "" {
+					return types.PostResult{}, nil, failure.Errorf(failure.Validation, "slack webhook url missing")
+				}
+				target = webhook
 			}
-			allowed, err := policyconstraints.HostAllowed(constraints, webhook)
+			allowed, err := policyconstraints.HostAllowed(constraints, target)
 			if err != nil {
-				return nil, err
+				return types.PostResult{}, nil, failure.New(failure.Validation, err)
 			}
 			if !allowed {
-				return nil, fmt.Errorf("webhook host not allowed by policy")
+				return types.PostResult{}, nil, failure.Errorf(failure.PolicyDenied, "webhook host not allowed by policy")
 			}
-			message := strings.TrimSpace(input.Summary.SummaryMarkdown)
-			if message == "" {
-				message = fmt.Sprintf("Incident %s summary ready", input.Incident.IncidentID)
+			var slackResult *types.SlackResult
+			if webhook != "" {
+				slackResult, err = slack.PostWebhook(ctx, webhook, message)
+			} else {
+				channel := strings.TrimSpace(input.Incident.Destination.SlackChannel)
+				if channel == "" {
+					channel = cfg.SlackChannel
+				}
+				threadTS := ""
+				if original != nil && original.Slack != nil && original.Slack.Ts != "" {
+					threadTS = original.Slack.Ts
+					if original.Slack.Channel != "" {
+						channel = original.Slack.Channel
+					}
+				}
+				if channel == "" {
+					return types.PostResult{}, nil, failure.Errorf(failure.Validation, "slack channel missing")
+				}
+				slackResult, err = slack.PostMessage(ctx, cfg.SlackBotToken, channel, message, threadTS, eventType == types.EventResolve)
 			}
-			slackResult, err := slack.PostWebhook(ctx, webhook, message)
 			if err != nil {
-				return nil, err
+				return types.PostResult{}, nil, err
 			}
 			result.Slack = slackResult
+			// The message is out: cache it before the audit upload, and even
+			// if the job was cancelled meanwhile, so a failed upload or a
+			// shutdown does not make the retry post to Slack twice.
+			if err := remember(context.WithoutCancel(ctx)); err != nil {
+				return types.PostResult{}, nil, err
+			}
 			artifactPtr, _, err := artifacts.UploadText(ctx, gw, message, "text/plain", "audit", map[string]string{
 				"kind":       "post_payload",
 				"incident_id": input.Incident.IncidentID,
 			}, maxBytes)
 			if err != nil {
-				return nil, err
+				return types.PostResult{}, nil, err
 			}
 			result.ArtifactPtr = artifactPtr
 		case "artifact":
 			payload := map[string]any{
 				"incident": input.Incident,
-				"summary":  input.Summary,
+			}
+			if eventType == types.EventTrigger {
+				payload["summary"] = input.Summary
+			} else {
+				payload["message"] = message
+				if original != nil {
+					payload["original"] = original
+				}
 			}
 			artifactPtr, _, err := artifacts.UploadJSON(ctx, gw, payload, "audit", map[string]string{
 				"kind":       "post_payload",
 				"incident_id": input.Incident.IncidentID,
 			}, maxBytes)
 			if err != nil {
-				return nil, err
+				return types.PostResult{}, nil, err
 			}
 			result.ArtifactPtr = artifactPtr
 		default:
-			return nil, fmt.Errorf("unsupported destination mode: %s", mode)
+			return types.PostResult{}, nil, failure.Errorf(failure.Validation, "unsupported destination mode: %s", mode)
 		}
 
-		if err := storeCachedPost(ctx, mem.Client(), cacheKey, result, cfg.DataTTL); err != nil {
-			return nil, err
+		if err := remember(ctx); err != nil {
+			return types.PostResult{}, nil, err
 		}
-		return buildResult(ctx, mem, cfg, req, result, start)
+		return result, postArtifacts(result), nil
 	}
 
-	subject := fmt.Sprintf("worker.%s.jobs", cfg.WorkerID)
-	w := &worker.Worker{
-		NATS:     nc,
-		Subject:  subject,
-		Handler:  handler,
-		SenderID: cfg.WorkerID,
-	}
-	if err := w.Start(); err != nil {
+	if err := runtime.Run(rt, "job.incident-enricher.post", handler); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-	go worker.HeartbeatLoop(ctx, nc, func() ([]byte, error) {
-		return worker.HeartbeatPayload(cfg.WorkerID, cfg.WorkerPool, 0, cfg.MaxParallelJobs, 0)
-	})
-
-	log.Printf("poster listening on %s for job.incident-enricher.post (worker_id=%s pool=%s)", subject, cfg.WorkerID, cfg.WorkerPool)
-	<-ctx.Done()
+// followUpMessage describes an update or resolve for the incident, pointing
+// back at the original post when there is one.
+func followUpMessage(incident types.IncidentInput, original *types.PostResult) string {
+	verb := "updated"
+	if incident.EventType == types.EventResolve {
+		verb = "resolved"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Incident %s %s", incident.IncidentID, verb)
+	if title := strings.TrimSpace(incident.Title); title != "" {
+		fmt.Fprintf(&b, ": %s", title)
+	}
+	if incident.Severity != "" {
+		fmt.Fprintf(&b, "\nSeverity: %s", incident.Severity)
+	}
+	if status, ok := incident.Raw["status"].(string); ok && status != "" {
+		fmt.Fprintf(&b, "\nStatus: %s", status)
+	}
+	if incident.Source.URL != "" {
+		fmt.Fprintf(&b, "\n%s", incident.Source.URL)
+	}
+	if original != nil && original.PostedAt != "" && (original.Slack == nil || original.Slack.Ts == "") {
+		fmt.Fprintf(&b, "\n(follow-up to the summary posted at %s)", original.PostedAt)
+	}
+	return b.String()
 }
 
 func getCachedPost(ctx context.Context, client *redis.Client, key string) (types.PostResult, bool, error) {
@@ -182,21 +252,9 @@ func storeCachedPost(ctx context.Context, client *redis.Client, key string, resu
 	return client.Set(ctx, key, data, ttl).Err()
 }
 
-func buildResult(ctx context.Context, mem *store.Store, cfg config.Env, req *agentv1.JobRequest, result types.PostResult, start time.Time) (*agentv1.JobResult, error) {
-	resultPtr, err := mem.PutResultJSON(ctx, req.GetJobId(), result)
-	if err != nil {
-		return nil, err
-	}
-	artifactPtrs := []string{}
-	if result.ArtifactPtr != "" {
-		artifactPtrs = append(artifactPtrs, result.ArtifactPtr)
+func postArtifacts(result types.PostResult) []string {
+	if result.ArtifactPtr == "" {
+		return nil
 	}
-	return &agentv1.JobResult{
-		JobId:        req.GetJobId(),
-		Status:       agentv1.JobStatus_JOB_STATUS_SUCCEEDED,
-		ResultPtr:    resultPtr,
-		WorkerId:     cfg.WorkerID,
-		ExecutionMs:  time.Since(start).Milliseconds(),
-		ArtifactPtrs: artifactPtrs,
-	}, nil
+	return []string{result.ArtifactPtr}
 }
@@ -2,129 +2,230 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
-	"time"
-	"unicode/utf8"
 
 	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
-	"github.com/coretexos/cap/v2/sdk/go/worker"
 	"github.com/coretexos/coretex-incident-enricher/internal/artifacts"
 	"github.com/coretexos/coretex-incident-enricher/internal/config"
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
 	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
 	"github.com/coretexos/coretex-incident-enricher/internal/llm"
+	"github.com/coretexos/coretex-incident-enricher/internal/metrics"
 	"github.com/coretexos/coretex-incident-enricher/internal/policyconstraints"
-	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/runtime"
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
-	"github.com/nats-io/nats.go"
+	"github.com/coretexos/coretex-incident-enricher/pack"
 )
 
+var cacheLookups = metrics.NewCounter("summary_cache_lookups_total", "Summary cache lookups, by result (hit or miss).", "result")
+
 type summarizerInput struct {
 	Evidence types.EvidenceBundle `json:"evidence"`
 }
 
 func main() {
-	cfg := config.Load("summarizer")
-
-	nc, err := nats.Connect(cfg.NATSURL)
+	rt, err := runtime.New("summarizer")
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer nc.Close()
+	defer rt.Close()
+	cfg, mem, gw := rt.Config, rt.Store, rt.Gateway
 
-	mem, err := store.New(cfg.RedisURL, cfg.DataTTL)
+	settings := llmSettings(cfg)
+	summarizer := llm.NewSummarizer(settings)
+
+	promptsFS := pack.Prompts()
+	if cfg.LLMPromptsDir != "" {
+		promptsFS = os.DirFS(cfg.LLMPromptsDir)
+	}
+	prompts, err := llm.LoadTemplates(promptsFS)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	gw := gatewayclient.New(cfg.GatewayURL, cfg.APIKey)
-
-	handler := func(ctx context.Context, req *agentv1.JobRequest) (*agentv1.JobResult, error) {
-		start := time.Now()
-		ctxPtr := req.GetContextPtr()
-		if ctxPtr == "" && req.Env != nil {
-			ctxPtr = req.Env["context_ptr"]
-		}
-		var input summarizerInput
-		if err := mem.GetContextJSON(ctx, ctxPtr, &input); err != nil {
-			return nil, err
-		}
+	handler := func(ctx context.Context, input summarizerInput) (types.Summary, []string, error) {
 		if input.Evidence.IncidentID == "" {
-			return nil, errors.New("missing evidence in input")
+			return types.Summary{}, nil, failure.Errorf(failure.Validation, "missing evidence in input")
 		}
+		req := runtime.Job(ctx)
 		redaction := policyconstraints.RedactionLevel(req.Env)
-		evidenceText := collectEvidenceText(ctx, gw, input.Evidence, cfg.LLMMaxEvidenceItems, cfg.LLMMaxEvidenceBytes)
-		settings := llm.Settings{
-			Provider:       cfg.LLMProvider,
-			OpenAIAPIKey:   cfg.OpenAIAPIKey,
-			OpenAIModel:    cfg.OpenAIModel,
-			OllamaURL:      cfg.OllamaURL,
-			OllamaModel:    cfg.OllamaModel,
-			OllamaTemp:     cfg.OllamaTemp,
-			MaxInputBytes:  cfg.LLMMaxInputBytes,
-			MaxEvidence:    cfg.LLMMaxEvidenceItems,
-			MaxEvidenceLen: cfg.LLMMaxEvidenceBytes,
+		chunked := cfg.LLMSummaryMode == "chunked"
+		maxItems, maxEvidenceBytes := cfg.LLMMaxEvidenceItems, cfg.LLMMaxEvidenceBytes
+		if chunked {
+			maxItems = len(input.Evidence.Evidence)
+			maxEvidenceBytes = cfg.LLMChunkBytes * cfg.LLMMaxChunks
 		}
+		evidenceText, coverage := collectEvidenceText(ctx, gw, input.Evidence, maxItems, maxEvidenceBytes)
 		llmInput := llm.Input{
 			Bundle:   input.Evidence,
 			Evidence: evidenceText,
+			Template: prompts.Select(
+				promptTemplateName(req),
+				contextString(input.Evidence.NormalizedContext, "severity"),
+				contextString(input.Evidence.NormalizedContext, "source"),
+			),
+		}
+		cacheKey := summaryCacheKey(settings, cfg, llmInput, redaction)
+		var summary types.Summary
+		if cfg.SummaryCache {
+			hit, err := mem.GetJSON(ctx, cacheKey, &summary)
+			if err != nil {
+				log.Printf("summarizer: read summary cache: %v", err)
+			} else if hit && summary.ArtifactPtr != "" {
+				cacheLookups.Inc("hit")
+				summary.Cached = true
+				return summary, []string{summary.ArtifactPtr}, nil
+			}
+			cacheLookups.Inc("miss")
+		}
+
+		var err error
+		if chunked {
+			coverage.Chunks = len(llm.ChunkEvidence(evidenceText, cfg.LLMChunkBytes))
+			summary, err = summarizer.SummarizeChunked(ctx, llmInput, cfg.LLMChunkBytes, redaction)
+		} else {
+			summary, err = summarizer.Summarize(ctx, llmInput, redaction)
 		}
-		summary, err := llm.Summarize(ctx, settings, llmInput, redaction)
 		if err != nil {
-			return nil, err
+			return types.Summary{}, nil, err
 		}
+		summary.Coverage = &coverage
+		summary.SummaryMarkdown = strings.TrimRight(summary.SummaryMarkdown, "\n") + "\n\n" + coverageNote(coverage)
 		maxBytes := policyconstraints.MaxArtifactBytes(req.Env)
 		ptr, _, err := artifacts.UploadText(ctx, gw, summary.SummaryMarkdown, "text/markdown", "audit", map[string]string{
 			"kind":        "summary",
 			"incident_id": summary.IncidentID,
 		}, maxBytes)
 		if err != nil {
-			return nil, err
+			return types.Summary{}, nil, err
 		}
 		summary.ArtifactPtr = ptr
 
-		resultPtr, err := mem.PutResultJSON(ctx, req.GetJobId(), summary)
-		if err != nil {
-			return nil, err
-		}
-		return &agentv1.JobResult{
-			JobId:        req.GetJobId(),
-			Status:       agentv1.JobStatus_JOB_STATUS_SUCCEEDED,
-			ResultPtr:    resultPtr,
-			WorkerId:     cfg.WorkerID,
-			ExecutionMs:  time.Since(start).Milliseconds(),
-			ArtifactPtrs: []string{ptr},
-		}, nil
-	}
-
-	subject := fmt.Sprintf("worker.%s.jobs", cfg.WorkerID)
-	w := &worker.Worker{
-		NATS:     nc,
-		Subject:  subject,
-		Handler:  handler,
-		SenderID: cfg.WorkerID,
-	}
-	if err := w.Start(); err != nil {
+		if cfg.SummaryCache && cacheable(summary) {
+			if err := mem.PutJSON(ctx, cacheKey, summary); err != nil {
+				log.Printf("summarizer: write summary cache: %v", err)
+			}
+		}
+		return summary, []string{summary.ArtifactPtr}, nil
+	}
+
+	if err := runtime.Run(rt, "job.incident-enricher.summarize", handler); err != nil {
 		log.Fatal(err)
 	}
+}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer cancel()
-	go worker.HeartbeatLoop(ctx, nc, func() ([]byte, error) {
-		return worker.HeartbeatPayload(cfg.WorkerID, cfg.WorkerPool, 0, cfg.MaxParallelJobs, 0)
+// summaryCacheKey hashes everything that shapes the model's output: provider
+// chain, models and endpoints, provider options, prompt template version,
+// prompt limits, redaction and the evidence itself.
+func summaryCacheKey(settings llm.Settings, cfg config.Env, input llm.Input, redaction string) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	_ = enc.Encode([]any{
+		llm.ProviderChain(settings.Provider),
+		settings.OpenAI.Model, settings.OpenAI.BaseURL, settings.OpenAI.Temperature,
+		settings.Ollama.Model, settings.Ollama.URL, settings.Ollama.Temperature,
+		settings.Options,
+		settings.MaxInputTokens, settings.MaxInputBytes,
+		cfg.LLMSummaryMode, cfg.LLMChunkBytes,
+		input.TemplateVersion(),
+		strings.ToLower(strings.TrimSpace(redaction)),
+		input.Bundle.IncidentID,
+		input.Bundle.NormalizedContext,
 	})
+	for _, item := range input.Evidence {
+		_ = enc.Encode([]string{item.Kind, item.Title, item.ContentType})
+		h.Write([]byte(item.Content))
+		h.Write([]byte{0})
+	}
+	return "incident-enricher:summary:" + hex.EncodeToString(h.Sum(nil))
+}
 
-	log.Printf("summarizer listening on %s for job.incident-enricher.summarize (worker_id=%s pool=%s)", subject, cfg.WorkerID, cfg.WorkerPool)
-	<-ctx.Done()
+// cacheable skips summaries produced after a provider in the chain failed, so
+// a fallback (e.g. mock during an outage) is not served for the whole TTL.
+func cacheable(summary types.Summary) bool {
+	for _, attempt := range summary.Attempts {
+		if attempt.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func llmSettings(cfg config.Env) llm.Settings {
+	return llm.Settings{
+		Provider:       cfg.LLMProvider,
+		MaxInputBytes:  cfg.LLMMaxInputBytes,
+		MaxInputTokens: cfg.LLMMaxInputTokens,
+		MaxEvidence:    cfg.LLMMaxEvidenceItems,
+		MaxEvidenceLen: cfg.LLMMaxEvidenceBytes,
+		OpenAI: llm.OpenAISettings{
+			APIKey:      cfg.OpenAIAPIKey,
+			Model:       cfg.OpenAIModel,
+			BaseURL:     cfg.OpenAIBaseURL,
+			Temperature: cfg.OpenAITemp,
+		},
+		Ollama: llm.OllamaSettings{
+			URL:         cfg.OllamaURL,
+			Model:       cfg.OllamaModel,
+			Temperature: cfg.OllamaTemp,
+		},
+		Retry: llm.RetryPolicy{
+			Attempts: cfg.LLMRetryAttempts,
+			Backoff:  cfg.LLMRetryBackoff,
+		},
+		ProviderRetry:    providerRetry(cfg),
+		ChunkConcurrency: cfg.LLMChunkConcurrency,
+		Breaker: llm.BreakerSettings{
+			Threshold: cfg.LLMBreakerThreshold,
+			Cooldown:  cfg.LLMBreakerCooldown,
+		},
+		Options: cfg.LLMOptions,
+	}
 }
 
-func collectEvidenceText(ctx context.Context, gw *gatewayclient.Client, bundle types.EvidenceBundle, maxItems, maxBytes int) []llm.EvidenceText {
+func providerRetry(cfg config.Env) map[string]llm.RetryPolicy {
+	out := map[string]llm.RetryPolicy{}
+	for name, attempts := range cfg.LLMProviderAttempts {
+		policy := out[name]
+		policy.Attempts = attempts
+		out[name] = policy
+	}
+	for name, backoff := range cfg.LLMProviderBackoff {
+		policy := out[name]
+		policy.Backoff = backoff
+		out[name] = policy
+	}
+	return out
+}
+
+// promptTemplateName reads an explicit template choice from the job env or
+// from the workflow step meta labels.
+func promptTemplateName(req *agentv1.JobRequest) string {
+	if name := strings.TrimSpace(req.GetEnv()["PROMPT_TEMPLATE"]); name != "" {
+		return name
+	}
+	return strings.TrimSpace(req.GetMeta().GetLabels()["prompt_template"])
+}
+
+func contextString(ctx map[string]any, key string) string {
+	if v, ok := ctx[key].(string); ok {
+		return strings.ToLower(strings.TrimSpace(v))
+	}
+	return ""
+}
+
+// collectEvidenceText fetches the bundle's artifacts and extracts their text,
+// keeping up to maxItems items and maxBytes bytes for the prompt. Coverage
+// counts bytes of extracted text, the unit the limits apply to, so items
+// past the limits are still fetched to measure them; an item whose artifact
+// cannot be fetched counts towards ItemsTotal but adds no bytes.
+func collectEvidenceText(ctx context.Context, gw *gatewayclient.Client, bundle types.EvidenceBundle, maxItems, maxBytes int) ([]llm.EvidenceText, types.EvidenceCoverage) {
 	if maxItems <= 0 {
 		maxItems = 4
 	}
@@ -132,17 +233,16 @@ func collectEvidenceText(ctx context.Context, gw *gatewayclient.Client, bundle t
 		maxBytes = 32768
 	}
 	var out []llm.EvidenceText
+	var coverage types.EvidenceCoverage
 	total := 0
 	for _, item := range bundle.Evidence {
 		if item.ArtifactPtr == "" {
 			continue
 		}
-		if len(out) >= maxItems || total >= maxBytes {
-			break
-		}
 		content, meta, err := gw.GetArtifact(ctx, item.ArtifactPtr)
 		if err != nil {
 			log.Printf("summarizer: fetch artifact %s: %v", item.ArtifactPtr, err)
+			coverage.ItemsTotal++
 			continue
 		}
 		contentType := item.ContentType
@@ -156,12 +256,16 @@ func collectEvidenceText(ctx context.Context, gw *gatewayclient.Client, bundle t
 		if text == "" {
 			continue
 		}
-		remaining := maxBytes - total
-		if remaining <= 0 {
-			break
+		coverage.ItemsTotal++
+		coverage.BytesTotal += int64(len(text))
+		if len(out) >= maxItems || total >= maxBytes {
+			continue
 		}
-		text = truncateToBytes(text, remaining)
+		remaining := maxBytes - total
+		text = llm.TrimToBytes(text, remaining)
 		total += len(text)
+		coverage.ItemsIncluded++
+		coverage.BytesIncluded += int64(len(text))
 		out = append(out, llm.EvidenceText{
 			Kind:        item.Kind,
 			Title:       item.Title,
@@ -170,7 +274,18 @@ func collectEvidenceText(ctx context.Context, gw *gatewayclient.Client, bundle t
 			Content:     text,
 		})
 	}
-	return out
+	return out, coverage
+}
+
+func coverageNote(c types.EvidenceCoverage) string {
+	note := fmt.Sprintf("_Evidence coverage: %d of %d item(s), %d of %d byte(s)", c.ItemsIncluded, c.ItemsTotal, c.BytesIncluded, c.BytesTotal)
+	if c.Chunks > 1 {
+		note += fmt.Sprintf(" across %d chunk(s)", c.Chunks)
+	}
+	if c.ItemsIncluded < c.ItemsTotal || c.BytesIncluded < c.BytesTotal {
+		return note + "; remaining evidence was not summarized._"
+	}
+	return note + "._"
 }
 
 func extractEvidenceText(content []byte, contentType string) string {
@@ -224,14 +339,3 @@ func stringField(payload map[string]any, key string) string {
 	}
 	return strings.TrimSpace(str)
 }
-
-func truncateToBytes(value string, maxBytes int) string {
-	if maxBytes <= 0 || len(value) <= maxBytes {
-		return value
-	}
-	truncated := value[:maxBytes]
-	for len(truncated) > 0 && !utf8.ValidString(truncated) {
-		truncated = truncated[:len(truncated)-1]
-	}
-	return truncated
-}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/config"
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/llm"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// artifactGateway serves the given artifacts by pointer; other pointers get
+// a 404.
+func artifactGateway(t *testing.T, artifacts map[string]string) *gatewayclient.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ptr := strings.TrimPrefix(r.URL.Path, "/api/v1/artifacts/")
+		content, ok := artifacts[ptr]
+		if !ok {
+			http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"artifact_ptr":   ptr,
+			"content_base64": base64.StdEncoding.EncodeToString([]byte(content)),
+			"metadata":       map[string]any{"content_type": "text/plain"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return gatewayclient.New(srv.URL, "")
+}
+
+func TestCollectEvidenceTextCoverage(t *testing.T) {
+	gw := artifactGateway(t, map[string]string{
+		"a1": strings.Repeat("a", 30),
+		// JSON artifacts count the extracted message, not the raw document.
+		"a2": `{"raw":{"message":"` + strings.Repeat("b", 30) + `"},"padding":"` + strings.Repeat(" ", 100) + `"}`,
+		"a3": strings.Repeat("c", 30),
+		"a4": "   ",
+	})
+	bundle := types.EvidenceBundle{Evidence: []types.EvidenceItem{
+		{Kind: "log", ArtifactPtr: "a1", Bytes: 999},
+		{Kind: "incident", ArtifactPtr: "a2", ContentType: "application/json", Bytes: 999},
+		{Kind: "log", ArtifactPtr: "a3", Bytes: 999},
+		{Kind: "log", ArtifactPtr: "a4"},
+		{Kind: "log", ArtifactPtr: "missing", Bytes: 999},
+		{Kind: "note"},
+	}}
+
+	tests := []struct {
+		name     string
+		maxItems int
+		maxBytes int
+		want     types.EvidenceCoverage
+		included []int
+	}{
+		{
+			name:     "everything fits",
+			maxItems: 10,
+			maxBytes: 1000,
+			want:     types.EvidenceCoverage{ItemsTotal: 4, ItemsIncluded: 3, BytesTotal: 90, BytesIncluded: 90},
+			included: []int{30, 30, 30},
+		},
+		{
+			name:     "item limit",
+			maxItems: 1,
+			maxBytes: 1000,
+			want:     types.EvidenceCoverage{ItemsTotal: 4, ItemsIncluded: 1, BytesTotal: 90, BytesIncluded: 30},
+			included: []int{30},
+		},
+		{
+			name:     "byte limit trims the last item",
+			maxItems: 10,
+			maxBytes: 85,
+			want:     types.EvidenceCoverage{ItemsTotal: 4, ItemsIncluded: 3, BytesTotal: 90, BytesIncluded: 85},
+			included: []int{30, 30, 25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, coverage := collectEvidenceText(context.Background(), gw, bundle, tt.maxItems, tt.maxBytes)
+			if coverage != tt.want {
+				t.Errorf("coverage = %+v, want %+v", coverage, tt.want)
+			}
+			if len(out) != len(tt.included) {
+				t.Fatalf("got %d items, want %d", len(out), len(tt.included))
+			}
+			for i, n := range tt.included {
+				if len(out[i].Content) != n {
+					t.Errorf("item %d has %d bytes, want %d", i, len(out[i].Content), n)
+				}
+			}
+		})
+	}
+}
+
+func TestCoverageNote(t *testing.T) {
+	full := coverageNote(types.EvidenceCoverage{ItemsTotal: 2, ItemsIncluded: 2, BytesTotal: 10, BytesIncluded: 10})
+	if full != "_Evidence coverage: 2 of 2 item(s), 10 of 10 byte(s)._" {
+		t.Errorf("full coverage note = %q", full)
+	}
+	partial := coverageNote(types.EvidenceCoverage{ItemsTotal: 2, ItemsIncluded: 2, BytesTotal: 10, BytesIncluded: 8, Chunks: 3})
+	if partial != "_Evidence coverage: 2 of 2 item(s), 8 of 10 byte(s) across 3 chunk(s); remaining evidence was not summarized._" {
+		t.Errorf("partial coverage note = %q", partial)
+	}
+}
+
+func TestSummaryCacheKey(t *testing.T) {
+	baseSettings := func() llm.Settings {
+		return llm.Settings{
+			Provider:       "ollama,openai",
+			MaxInputTokens: 8000,
+			OpenAI:         llm.OpenAISettings{APIKey: "sk-1", Model: "gpt-4o-mini", BaseURL: "https://api.openai.com/v1"},
+			Ollama:         llm.OllamaSettings{URL: "http://ollama:11434", Model: "llama3"},
+		}
+	}
+	baseInput := func() llm.Input {
+		return llm.Input{
+			Bundle:   types.EvidenceBundle{IncidentID: "inc-1", NormalizedContext: map[string]any{"severity": "high"}},
+			Evidence: []llm.EvidenceText{{Kind: "log", Title: "app.log", Content: "disk full"}},
+		}
+	}
+	cfg := config.Env{LLMSummaryMode: "single"}
+	base := summaryCacheKey(baseSettings(), cfg, baseInput(), "none")
+
+	changes := map[string]func(*llm.Settings, *config.Env, *llm.Input){
+		"provider order":  func(s *llm.Settings, _ *config.Env, _ *llm.Input) { s.Provider = "openai,ollama" },
+		"ollama endpoint": func(s *llm.Settings, _ *config.Env, _ *llm.Input) { s.Ollama.URL = "http://gpu-box:11434" },
+		"ollama model":    func(s *llm.Settings, _ *config.Env, _ *llm.Input) { s.Ollama.Model = "llama3:70b" },
+		"openai endpoint": func(s *llm.Settings, _ *config.Env, _ *llm.Input) { s.OpenAI.BaseURL = "http://vllm:8000/v1" },
+		"temperature":     func(s *llm.Settings, _ *config.Env, _ *llm.Input) { s.OpenAI.Temperature = 0.7 },
+		"provider option": func(s *llm.Settings, _ *config.Env, _ *llm.Input) {
+			s.Options = map[string]string{"endpoint": "http://x"}
+		},
+		"token budget": func(s *llm.Settings, _ *config.Env, _ *llm.Input) { s.MaxInputTokens = 4000 },
+		"summary mode": func(_ *llm.Settings, c *config.Env, _ *llm.Input) { c.LLMSummaryMode = "chunked" },
+		"prompt template": func(_ *llm.Settings, _ *config.Env, in *llm.Input) {
+			in.Template = &llm.Template{Name: "default", Version: "abc"}
+		},
+		"evidence content":   func(_ *llm.Settings, _ *config.Env, in *llm.Input) { in.Evidence[0].Content = "disk full!" },
+		"evidence title":     func(_ *llm.Settings, _ *config.Env, in *llm.Input) { in.Evidence[0].Title = "db.log" },
+		"normalized context": func(_ *llm.Settings, _ *config.Env, in *llm.Input) { in.Bundle.NormalizedContext["severity"] = "low" },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			settings, env, input := baseSettings(), cfg, baseInput()
+			change(&settings, &env, &input)
+			if summaryCacheKey(settings, env, input, "none") == base {
+				t.Errorf("changing the %s kept the cache key", name)
+			}
+		})
+	}
+
+	settings := baseSettings()
+	settings.OpenAI.APIKey = "sk-2"
+	if summaryCacheKey(settings, cfg, baseInput(), " None ") != base {
+		t.Error("rotating the API key or re-spacing the redaction level changed the cache key")
+	}
+}
+
+func TestTemplateVersionCoversBuiltinPrompt(t *testing.T) {
+	builtin := llm.Input{}.TemplateVersion()
+	if !strings.HasPrefix(builtin, "builtin@") || len(builtin) <= len("builtin@") {
+		t.Errorf("built-in version %q does not identify the prompt text", builtin)
+	}
+	userOnly := llm.Input{Template: &llm.Template{Name: "default", Version: "abc"}}.TemplateVersion()
+	if userOnly != "default@abc+"+builtin {
+		t.Errorf("template without a system half = %q, want it to carry the built-in version", userOnly)
+	}
+}
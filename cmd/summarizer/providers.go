@@ -0,0 +1,7 @@
+package main
+
+// Built-in providers (mock, ollama, openai) register themselves from
+// internal/llm. Out-of-tree providers are linked in with a blank import here
+// and selected at runtime via LLM_PROVIDER, e.g.:
+//
+//	import _ "example.com/yourteam/llmprovider"
@@ -14,6 +14,7 @@ const (
 	defaultWorkerPool = "incident-enricher-default"
 	defaultDataTTL    = 24 * time.Hour
 	defaultOllamaURL  = "http://localhost:11434"
+	defaultOpenAIURL  = "https://api.openai.com/v1"
 )
 
 type Env struct {
@@ -25,17 +26,59 @@ type Env struct {
 	WorkerPool          string
 	WorkerID            string
 	MaxParallelJobs     int
+	DrainTimeout        time.Duration
+	JobTimeout          time.Duration
+	DebugAddr           string
+	MetricsAddr         string
+	TracesExporter      string
 	DataTTL             time.Duration
 	LLMProvider         string
 	OpenAIAPIKey        string
 	OpenAIModel         string
+	OpenAIBaseURL       string
+	OpenAITemp          float64
 	OllamaURL           string
 	OllamaModel         string
 	OllamaTemp          float64
 	SlackWebhookURL     string
+	SlackBotToken       string
+	SlackChannel        string
 	LLMMaxInputBytes    int
+	LLMMaxInputTokens   int
 	LLMMaxEvidenceBytes int
 	LLMMaxEvidenceItems int
+	LLMOptions          map[string]string
+	LLMSummaryMode      string
+	LLMPromptsDir       string
+	SummaryCache        bool
+	LLMChunkBytes       int
+	LLMMaxChunks        int
+	LLMChunkConcurrency int
+	LLMRetryAttempts    int
+	LLMRetryBackoff     time.Duration
+	LLMProviderAttempts map[string]int
+	LLMProviderBackoff  map[string]time.Duration
+	LLMBreakerThreshold int
+	LLMBreakerCooldown  time.Duration
+	DedupWindow         time.Duration
+	DedupMode           string
+	DedupFields         []string
+	FlapWindow          time.Duration
+	FlapThreshold       int
+	IngestQueue         bool
+	IngestBackoff       time.Duration
+	IngestMaxBackoff    time.Duration
+	IngestMaxAttempts   int
+	IngestMaxBodyBytes  int64
+	IngestBatchMaxBytes int64
+	IngestBatchMaxItems int
+	IngestRateSource    float64
+	IngestBurstSource   int
+	IngestRateIP        float64
+	IngestBurstIP       int
+	IngestTrustXFF      bool
+	IngestShutdown      time.Duration
+	IngestShutdownDelay time.Duration
 }
 
 func Load(service string) Env {
@@ -70,18 +113,70 @@ func Load(service string) Env {
 		cfg.WorkerID = service + "-" + host
 	}
 	cfg.MaxParallelJobs = getenvInt("WORKER_MAX_PARALLEL", 1)
+	cfg.DrainTimeout = getenvDuration("WORKER_DRAIN_TIMEOUT", 30*time.Second)
+	cfg.JobTimeout = getenvDuration("WORKER_JOB_TIMEOUT", 0)
+	cfg.DebugAddr = strings.TrimSpace(os.Getenv("DEBUG_ADDR"))
+	cfg.MetricsAddr = strings.TrimSpace(os.Getenv("METRICS_ADDR"))
+	cfg.TracesExporter = strings.ToLower(strings.TrimSpace(getenv("OTEL_TRACES_EXPORTER", "none")))
 	cfg.DataTTL = parseDataTTL()
 
 	cfg.LLMProvider = strings.TrimSpace(os.Getenv("LLM_PROVIDER"))
 	cfg.OpenAIAPIKey = strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
 	cfg.OpenAIModel = strings.TrimSpace(os.Getenv("OPENAI_MODEL"))
+	cfg.OpenAIBaseURL = getenv("OPENAI_BASE_URL", defaultOpenAIURL)
+	cfg.OpenAITemp = getenvFloat("OPENAI_TEMPERATURE", 0.2)
 	cfg.OllamaURL = getenv("OLLAMA_URL", defaultOllamaURL)
 	cfg.OllamaModel = strings.TrimSpace(os.Getenv("OLLAMA_MODEL"))
 	cfg.OllamaTemp = getenvFloat("OLLAMA_TEMPERATURE", 0.2)
 	cfg.SlackWebhookURL = strings.TrimSpace(os.Getenv("SLACK_WEBHOOK_URL"))
+	cfg.SlackBotToken = strings.TrimSpace(os.Getenv("SLACK_BOT_TOKEN"))
+	cfg.SlackChannel = strings.TrimSpace(os.Getenv("SLACK_CHANNEL"))
 	cfg.LLMMaxInputBytes = getenvInt("LLM_MAX_INPUT_BYTES", 65536)
+	cfg.LLMMaxInputTokens = getenvInt("LLM_MAX_INPUT_TOKENS", 16384)
 	cfg.LLMMaxEvidenceBytes = getenvInt("LLM_MAX_EVIDENCE_BYTES", 32768)
 	cfg.LLMMaxEvidenceItems = getenvInt("LLM_MAX_EVIDENCE_ITEMS", 4)
+	cfg.LLMOptions = getenvPrefixed("LLM_OPTION_")
+	cfg.LLMSummaryMode = strings.ToLower(getenv("LLM_SUMMARY_MODE", "single"))
+	cfg.LLMPromptsDir = strings.TrimSpace(os.Getenv("LLM_PROMPTS_DIR"))
+	cfg.SummaryCache = getenvBool("SUMMARY_CACHE_ENABLED", true)
+	cfg.LLMChunkBytes = getenvInt("LLM_CHUNK_BYTES", 16384)
+	cfg.LLMMaxChunks = getenvInt("LLM_MAX_CHUNKS", 32)
+	cfg.LLMChunkConcurrency = getenvInt("LLM_CHUNK_CONCURRENCY", 4)
+	cfg.LLMRetryAttempts = getenvInt("LLM_RETRY_ATTEMPTS", 2)
+	cfg.LLMRetryBackoff = getenvDuration("LLM_RETRY_BACKOFF", 500*time.Millisecond)
+	cfg.LLMProviderAttempts = map[string]int{}
+	for name, raw := range getenvPrefixed("LLM_RETRY_ATTEMPTS_") {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			cfg.LLMProviderAttempts[name] = v
+		}
+	}
+	cfg.LLMProviderBackoff = map[string]time.Duration{}
+	for name, raw := range getenvPrefixed("LLM_RETRY_BACKOFF_") {
+		if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+			cfg.LLMProviderBackoff[name] = d
+		}
+	}
+	cfg.LLMBreakerThreshold = getenvInt("LLM_BREAKER_THRESHOLD", 3)
+	cfg.LLMBreakerCooldown = getenvDuration("LLM_BREAKER_COOLDOWN", time.Minute)
+	cfg.DedupWindow = getenvDuration("INGESTER_DEDUP_WINDOW", 0)
+	cfg.DedupMode = strings.ToLower(getenv("INGESTER_DEDUP_MODE", "attach"))
+	cfg.DedupFields = getenvList("INGESTER_DEDUP_FIELDS", []string{"source.system", "incident_id"})
+	cfg.FlapWindow = getenvDuration("INGESTER_FLAP_WINDOW", 0)
+	cfg.FlapThreshold = getenvInt("INGESTER_FLAP_THRESHOLD", 4)
+	cfg.IngestQueue = getenvBool("INGESTER_QUEUE_ENABLED", false)
+	cfg.IngestBackoff = getenvDuration("INGESTER_QUEUE_BACKOFF", time.Second)
+	cfg.IngestMaxBackoff = getenvDuration("INGESTER_QUEUE_MAX_BACKOFF", time.Minute)
+	cfg.IngestMaxAttempts = getenvInt("INGESTER_QUEUE_MAX_ATTEMPTS", 0)
+	cfg.IngestMaxBodyBytes = int64(getenvInt("INGESTER_MAX_BODY_BYTES", 1<<20))
+	cfg.IngestBatchMaxBytes = int64(getenvInt("INGESTER_BATCH_MAX_BODY_BYTES", 16<<20))
+	cfg.IngestBatchMaxItems = getenvInt("INGESTER_BATCH_MAX_ITEMS", 1000)
+	cfg.IngestRateSource = getenvFloat("INGESTER_RATE_LIMIT_PER_SOURCE", 0)
+	cfg.IngestBurstSource = getenvInt("INGESTER_RATE_BURST_PER_SOURCE", 0)
+	cfg.IngestRateIP = getenvFloat("INGESTER_RATE_LIMIT_PER_IP", 0)
+	cfg.IngestBurstIP = getenvInt("INGESTER_RATE_BURST_PER_IP", 0)
+	cfg.IngestTrustXFF = getenvBool("INGESTER_TRUST_X_FORWARDED_FOR", false)
+	cfg.IngestShutdown = getenvDuration("INGESTER_SHUTDOWN_TIMEOUT", 20*time.Second)
+	cfg.IngestShutdownDelay = getenvDuration("INGESTER_SHUTDOWN_DELAY", 5*time.Second)
 
 	return cfg
 }
@@ -118,6 +213,59 @@ func getenvFloat(key string, fallback float64) float64 {
 	return parsed
 }
 
+func getenvBool(key string, fallback bool) bool {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(val)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func getenvDuration(key string, fallback time.Duration) time.Duration {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(val)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+	return parsed
+}
+
+func getenvList(key string, fallback []string) []string {
+	var out []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	if len(out) == 0 {
+		return fallback
+	}
+	return out
+}
+
+func getenvPrefixed(prefix string) map[string]string {
+	out := map[string]string{}
+	for _, kv := range os.Environ() {
+		key, val, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, prefix))
+		if name == "" {
+			continue
+		}
+		out[name] = strings.TrimSpace(val)
+	}
+	return out
+}
+
 func parseDataTTL() time.Duration {
 	if raw := strings.TrimSpace(os.Getenv("REDIS_DATA_TTL_SECONDS")); raw != "" {
 		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
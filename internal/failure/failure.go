@@ -0,0 +1,120 @@
+// Package failure classifies step errors so workers report them with a
+// JobStatus and error code the scheduler can act on. Transient upstream
+// failures and timeouts are worth retrying up to the topic's max_retries;
+// bad input, policy denials and permanent upstream rejections are not.
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
+)
+
+// Kind is the class of a step failure; its value is the JobResult error code.
+type Kind string
+
+const (
+	// Validation means the job's input is unusable as sent.
+	Validation Kind = "validation"
+	// PolicyDenied means the job's policy constraints forbid the action.
+	PolicyDenied Kind = "policy_denied"
+	// UpstreamTransient means a dependency failed in a way that may clear:
+	// connection errors, 5xx and 429 responses, open circuit breakers.
+	UpstreamTransient Kind = "upstream_transient"
+	// UpstreamPermanent means a dependency rejected the request and will
+	// keep doing so: 4xx responses, bad credentials, unknown channels.
+	UpstreamPermanent Kind = "upstream_permanent"
+	// Timeout means the job or a call it made ran out of time.
+	Timeout Kind = "timeout"
+)
+
+// Retryable reports whether running the job again may succeed. Schedulers
+// that read error codes should retry only these kinds.
+func (k Kind) Retryable() bool {
+	return k == UpstreamTransient || k == Timeout
+}
+
+// Status is the JobStatus reported for k.
+//
+// CAP does not say which statuses an orchestrator retries: the state
+// machine (cap spec/07-state-machine.md) makes FAILED, TIMEOUT, CANCELLED
+// and DENIED all terminal, and the job protocol (spec/03, "Idempotency and
+// Retries") leaves re-dispatch to the producer. CANCELLED is the state a
+// controller uses to stop a job, so a step never reports it for its own
+// failures: bad input and permanent upstream rejections are FAILED like
+// transient ones, and the error code, which is k, is the stable signal of
+// whether a retry can help (see Retryable). Policy denials are DENIED, the
+// safety kernel's refusal (spec/06-safety.md), and timeouts TIMEOUT.
+func (k Kind) Status() agentv1.JobStatus {
+	switch k {
+	case PolicyDenied:
+		return agentv1.JobStatus_JOB_STATUS_DENIED
+	case Timeout:
+		return agentv1.JobStatus_JOB_STATUS_TIMEOUT
+	default:
+		return agentv1.JobStatus_JOB_STATUS_FAILED
+	}
+}
+
+// Error is an error tagged with its Kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New tags err with kind; a nil err stays nil.
+func New(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf formats an error tagged with kind.
+func Errorf(kind Kind, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// HTTP tags err by the status code of the response that caused it: server
+// errors, 408 and 429 are transient, other codes permanent.
+func HTTP(statusCode int, err error) error {
+	if statusCode >= 500 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests {
+		return New(UpstreamTransient, err)
+	}
+	return New(UpstreamPermanent, err)
+}
+
+// Classify returns the Kind of err. Untagged errors are classified by what
+// they wrap: deadlines and network timeouts are Timeout, other network
+// errors transient, and errors with a Temporary method (such as gateway
+// status errors) follow it. Anything else is treated as transient, so an
+// unclassified error keeps the retry behaviour it had before.
+func Classify(err error) Kind {
+	var tagged *Error
+	if errors.As(err, &tagged) {
+		return tagged.Kind
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return Timeout
+		}
+		return UpstreamTransient
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && !temporary.Temporary() {
+		return UpstreamPermanent
+	}
+	return UpstreamTransient
+}
@@ -0,0 +1,80 @@
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+
+	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
+)
+
+// temporaryError follows the Temporary convention of gateway status errors.
+type temporaryError bool
+
+func (e temporaryError) Error() string   { return "status error" }
+func (e temporaryError) Temporary() bool { return bool(e) }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Kind
+	}{
+		{"tagged", Errorf(Validation, "incident_id missing"), Validation},
+		{"tagged and wrapped", fmt.Errorf("post: %w", New(PolicyDenied, errors.New("host"))), PolicyDenied},
+		{"outer tag wins", New(UpstreamPermanent, New(Timeout, errors.New("x"))), UpstreamPermanent},
+		{"deadline", fmt.Errorf("summarize: %w", context.DeadlineExceeded), Timeout},
+		{"network timeout", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, Timeout},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, UpstreamTransient},
+		{"permanent status", fmt.Errorf("start run: %w", temporaryError(false)), UpstreamPermanent},
+		{"temporary status", temporaryError(true), UpstreamTransient},
+		{"http 503", HTTP(http.StatusServiceUnavailable, errors.New("x")), UpstreamTransient},
+		{"http 429", HTTP(http.StatusTooManyRequests, errors.New("x")), UpstreamTransient},
+		{"http 408", HTTP(http.StatusRequestTimeout, errors.New("x")), UpstreamTransient},
+		{"http 404", HTTP(http.StatusNotFound, errors.New("x")), UpstreamPermanent},
+		{"untagged", errors.New("something broke"), UpstreamTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewKeepsNil(t *testing.T) {
+	if New(Validation, nil) != nil {
+		t.Error("New tagged a nil error")
+	}
+	err := New(Validation, context.Canceled)
+	if !errors.Is(err, context.Canceled) || err.Error() != context.Canceled.Error() {
+		t.Errorf("tagged error %v does not wrap its cause", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		kind      Kind
+		status    agentv1.JobStatus
+		retryable bool
+	}{
+		{UpstreamTransient, agentv1.JobStatus_JOB_STATUS_FAILED, true},
+		{Timeout, agentv1.JobStatus_JOB_STATUS_TIMEOUT, true},
+		{Validation, agentv1.JobStatus_JOB_STATUS_FAILED, false},
+		{UpstreamPermanent, agentv1.JobStatus_JOB_STATUS_FAILED, false},
+		{PolicyDenied, agentv1.JobStatus_JOB_STATUS_DENIED, false},
+	}
+	for _, tt := range tests {
+		if got := tt.kind.Status(); got != tt.status {
+			t.Errorf("%s.Status() = %s, want %s", tt.kind, got, tt.status)
+		}
+		if got := tt.kind.Retryable(); got != tt.retryable {
+			t.Errorf("%s.Retryable() = %v, want %v", tt.kind, got, tt.retryable)
+		}
+	}
+}
@@ -11,8 +11,33 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/metrics"
+	"github.com/coretexos/coretex-incident-enricher/internal/tracing"
 )
 
+// StatusError is a non-2xx response from the gateway.
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("gateway %s %s: %s", e.Method, e.Path, e.Message)
+}
+
+// Temporary reports whether retrying the request may succeed: server errors,
+// timeouts and rate limiting are, other client errors are not.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
 type Client struct {
 	BaseURL string
 	APIKey  string
@@ -27,7 +52,21 @@ func New(baseURL, apiKey string) *Client {
 	}
 }
 
-func (c *Client) PutArtifact(ctx context.Context, content []byte, contentType, retention string, labels map[string]string, maxBytes int64) (string, int, error) {
+var (
+	artifactUploads     = metrics.NewCounter("artifact_uploads_total", "Artifact uploads to the gateway, by outcome.", "outcome")
+	artifactUploadBytes = metrics.NewCounter("artifact_upload_bytes_total", "Bytes of artifact content uploaded to the gateway.")
+)
+
+func (c *Client) PutArtifact(ctx context.Context, content []byte, contentType, retention string, labels map[string]string, maxBytes int64) (ptr string, size int, err error) {
+	ctx, span := tracing.Start(ctx, "gateway.PutArtifact", trace.SpanKindClient,
+		attribute.String("artifact.content_type", contentType),
+		attribute.Int("artifact.size_bytes", len(content)),
+		attribute.String("artifact.kind", labels["kind"]),
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("artifact.ptr", ptr))
+		tracing.End(span, err)
+	}()
 	payload := map[string]any{
 		"content_base64": base64.StdEncoding.EncodeToString(content),
 		"content_type":   strings.TrimSpace(contentType),
@@ -43,15 +82,21 @@ func (c *Client) PutArtifact(ctx context.Context, content []byte, contentType, r
 		headers["X-Max-Artifact-Bytes"] = fmt.Sprintf("%d", maxBytes)
 	}
 	if err := c.doJSON(ctx, http.MethodPost, "/api/v1/artifacts", payload, &resp, headers); err != nil {
+		artifactUploads.Inc("error")
 		return "", 0, err
 	}
 	if resp.ArtifactPtr == "" {
+		artifactUploads.Inc("error")
 		return "", 0, fmt.Errorf("artifact ptr missing from response")
 	}
+	artifactUploads.Inc("ok")
+	artifactUploadBytes.Add(float64(len(content)))
 	return resp.ArtifactPtr, resp.SizeBytes, nil
 }
 
-func (c *Client) GetArtifact(ctx context.Context, ptr string) ([]byte, map[string]any, error) {
+func (c *Client) GetArtifact(ctx context.Context, ptr string) (data []byte, metadata map[string]any, err error) {
+	ctx, span := tracing.Start(ctx, "gateway.GetArtifact", trace.SpanKindClient, attribute.String("artifact.ptr", ptr))
+	defer func() { tracing.End(span, err) }()
 	escaped := url.PathEscape(ptr)
 	var resp struct {
 		ArtifactPtr   string         `json:"artifact_ptr"`
@@ -61,14 +106,45 @@ func (c *Client) GetArtifact(ctx context.Context, ptr string) ([]byte, map[strin
 	if err := c.doJSON(ctx, http.MethodGet, "/api/v1/artifacts/"+escaped, nil, &resp, nil); err != nil {
 		return nil, nil, err
 	}
-	data, err := base64.StdEncoding.DecodeString(resp.ContentBase64)
+	data, err = base64.StdEncoding.DecodeString(resp.ContentBase64)
 	if err != nil {
 		return nil, nil, fmt.Errorf("decode artifact: %w", err)
 	}
 	return data, resp.Metadata, nil
 }
 
-func (c *Client) StartRun(ctx context.Context, workflowID string, payload map[string]any, idempotencyKey string) (string, error) {
+// Ping checks that the gateway answers HTTP. Any response below 500 counts,
+// since reachability rather than a particular endpoint is what matters.
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 500 {
+		return &StatusError{Method: http.MethodGet, Path: "/health", StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	return nil
+}
+
+func (c *Client) StartRun(ctx context.Context, workflowID string, payload map[string]any, idempotencyKey string) (runID string, err error) {
+	incidentID, _ := payload["incident_id"].(string)
+	ctx, span := tracing.Start(ctx, "gateway.StartRun", trace.SpanKindClient,
+		attribute.String("workflow.id", workflowID),
+		attribute.String("incident.id", incidentID),
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("workflow.run_id", runID))
+		tracing.End(span, err)
+	}()
 	escaped := url.PathEscape(workflowID)
 	headers := map[string]string{}
 	if strings.TrimSpace(idempotencyKey) != "" {
@@ -112,18 +188,21 @@ func (c *Client) doJSON(ctx context.Context, method, path string, body any, out
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
+	// The gateway carries the trace context into the run's jobs.
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		msg := strings.TrimSpace(string(respBody))
 		if msg == "" {
 			msg = resp.Status
 		}
-		return fmt.Errorf("gateway %s %s: %s", method, path, msg)
+		return &StatusError{Method: method, Path: path, StatusCode: resp.StatusCode, Message: msg}
 	}
 	if out != nil {
 		if err := json.Unmarshal(respBody, out); err != nil {
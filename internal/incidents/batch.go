@@ -0,0 +1,66 @@
+package incidents
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// MaxLineBytes bounds one NDJSON record.
+const MaxLineBytes = 1 << 20
+
+// ReadNDJSON decodes one IncidentInput per non-blank line of r and calls fn
+// with its 1-based line number. Lines that do not decode are passed to fn
+// with a non-nil err so callers can report them and carry on; an error
+// returned by fn stops the read.
+func ReadNDJSON(r io.Reader, fn func(line int, input types.IncidentInput, err error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var input types.IncidentInput
+		err := json.Unmarshal(data, &input)
+		if err != nil {
+			err = fmt.Errorf("invalid json: %w", err)
+		}
+		if ferr := fn(line, input, err); ferr != nil {
+			return ferr
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("line %d: longer than %d bytes", line+1, MaxLineBytes)
+		}
+		return fmt.Errorf("read ndjson: %w", err)
+	}
+	return nil
+}
+
+// IdempotencyKey derives a stable key from prefix and the full input, so
+// resubmitting the same record returns the existing run while any change to
+// the record, or a new prefix, starts a fresh one.
+func IdempotencyKey(prefix string, input types.IncidentInput) string {
+	data, _ := json.Marshal(input)
+	sum := sha256.Sum256(data)
+	return prefix + ":" + input.IncidentID + ":" + hex.EncodeToString(sum[:12])
+}
+
+// ToMap converts input to the generic map StartRun sends as the run input.
+func ToMap(input types.IncidentInput) map[string]any {
+	out := map[string]any{}
+	data, _ := json.Marshal(input)
+	_ = json.Unmarshal(data, &out)
+	return out
+}
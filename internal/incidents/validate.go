@@ -0,0 +1,105 @@
+package incidents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/schema"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+	"github.com/coretexos/coretex-incident-enricher/pack"
+)
+
+var (
+	inputSchemaOnce sync.Once
+	inputSchema     *schema.Schema
+	inputSchemaErr  error
+)
+
+// severitySynonyms maps common severity spellings from alerting tools onto
+// the schema's low/medium/high/critical enum.
+var severitySynonyms = map[string]string{
+	"critical": "critical", "crit": "critical", "fatal": "critical", "emergency": "critical",
+	"page": "critical", "disaster": "critical", "p0": "critical", "p1": "critical",
+	"sev0": "critical", "sev1": "critical",
+
+	"high": "high", "error": "high", "err": "high", "major": "high", "p2": "high", "sev2": "high",
+
+	"medium": "medium", "warning": "medium", "warn": "medium", "moderate": "medium",
+	"average": "medium", "p3": "medium", "sev3": "medium",
+
+	"low": "low", "info": "low", "informational": "low", "minor": "low", "none": "low",
+	"debug": "low", "p4": "low", "p5": "low", "sev4": "low", "sev5": "low",
+}
+
+// ValidationError lists every way an incident fails the IncidentInput schema.
+type ValidationError struct {
+	Violations []schema.Violation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.String())
+	}
+	return "invalid incident: " + strings.Join(parts, "; ")
+}
+
+// NormalizeSeverity maps value onto the severity enum, accepting case and
+// separator variants such as "P1", "SEV-2" or "Warning". It returns "" when
+// value is not a known severity.
+func NormalizeSeverity(value string) string {
+	key := strings.ToLower(strings.TrimSpace(value))
+	key = strings.NewReplacer("-", "", "_", "", " ", "").Replace(key)
+	return severitySynonyms[key]
+}
+
+// Normalize trims and lowercases the enum-like fields of input and maps
+// severity synonyms, so near-misses pass validation. Unknown severities are
+// left for ValidateInput to report.
+func Normalize(input *types.IncidentInput) {
+	input.IncidentID = strings.TrimSpace(input.IncidentID)
+	input.EventType = strings.ToLower(strings.TrimSpace(input.EventType))
+	input.Source.System = strings.ToLower(strings.TrimSpace(input.Source.System))
+	input.Destination.Mode = strings.ToLower(strings.TrimSpace(input.Destination.Mode))
+	if input.Severity != "" {
+		if severity := NormalizeSeverity(input.Severity); severity != "" {
+			input.Severity = severity
+		}
+	}
+}
+
+// ValidateInput checks input against the pack's IncidentInput schema, the
+// same one the workflow's input_schema enforces at the gateway. It returns a
+// *ValidationError listing the violations.
+func ValidateInput(input types.IncidentInput) error {
+	s, err := loadInputSchema()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("marshal incident: %w", err)
+	}
+	violations, err := s.ValidateJSON(data)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func loadInputSchema() (*schema.Schema, error) {
+	inputSchemaOnce.Do(func() {
+		data, err := pack.Schema("IncidentInput")
+		if err != nil {
+			inputSchemaErr = err
+			return
+		}
+		inputSchema, inputSchemaErr = schema.Compile(data)
+	})
+	return inputSchema, inputSchemaErr
+}
@@ -0,0 +1,124 @@
+package incidents
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+func TestNormalizeSeverity(t *testing.T) {
+	tests := map[string]string{
+		"critical": "critical",
+		" P1 ":     "critical",
+		"SEV-2":    "high",
+		"Error":    "high",
+		"warning":  "medium",
+		"sev_3":    "medium",
+		"info":     "low",
+		"P 5":      "low",
+		"urgent":   "",
+		"":         "",
+	}
+	for in, want := range tests {
+		if got := NormalizeSeverity(in); got != want {
+			t.Errorf("NormalizeSeverity(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	input := types.IncidentInput{
+		IncidentID:  "  inc-1\n",
+		EventType:   " Resolve ",
+		Title:       "  Disk Full  ",
+		Severity:    "SEV1",
+		Source:      types.SourceInfo{System: " PagerDuty ", URL: "https://example.com/Inc-1"},
+		Destination: types.Destination{Mode: "Slack", SlackChannel: "#Ops"},
+	}
+	Normalize(&input)
+	want := types.IncidentInput{
+		IncidentID: "inc-1",
+		EventType:  "resolve",
+		// Free text and URLs are left as sent.
+		Title:       "  Disk Full  ",
+		Severity:    "critical",
+		Source:      types.SourceInfo{System: "pagerduty", URL: "https://example.com/Inc-1"},
+		Destination: types.Destination{Mode: "slack", SlackChannel: "#Ops"},
+	}
+	if input.IncidentID != want.IncidentID || input.EventType != want.EventType || input.Title != want.Title ||
+		input.Severity != want.Severity || input.Source != want.Source || input.Destination != want.Destination {
+		t.Errorf("Normalize = %+v, want %+v", input, want)
+	}
+
+	unknown := types.IncidentInput{Severity: "Urgent"}
+	Normalize(&unknown)
+	if unknown.Severity != "Urgent" {
+		t.Errorf("unknown severity normalized to %q, want it left for validation", unknown.Severity)
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	valid := func() types.IncidentInput {
+		return types.IncidentInput{
+			IncidentID:  "inc-1",
+			EventType:   types.EventTrigger,
+			Severity:    "high",
+			Source:      types.SourceInfo{System: "pagerduty"},
+			Destination: types.Destination{Mode: "artifact"},
+		}
+	}
+	tests := []struct {
+		name   string
+		change func(*types.IncidentInput)
+		want   []string
+	}{
+		{name: "valid", change: func(*types.IncidentInput) {}},
+		{
+			name:   "missing fields",
+			change: func(in *types.IncidentInput) { in.IncidentID, in.Source.System = "", "" },
+			want:   []string{"incident_id: must be at least 1 character(s)", "source.system: must match ^[a-z0-9][a-z0-9_-]*$"},
+		},
+		{
+			name:   "unknown severity",
+			change: func(in *types.IncidentInput) { in.Severity = "urgent" },
+			want:   []string{"severity: must be one of [low, medium, high, critical]"},
+		},
+		{
+			name:   "unnormalized enums",
+			change: func(in *types.IncidentInput) { in.EventType, in.Destination.Mode = "Trigger", "Slack" },
+			want: []string{
+				"destination.mode: must be one of [artifact, slack]",
+				"event_type: must be one of [trigger, update, resolve]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid()
+			tt.change(&input)
+			err := ValidateInput(input)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want a *ValidationError", err)
+			}
+			got := make([]string, len(invalid.Violations))
+			for i, v := range invalid.Violations {
+				got[i] = v.String()
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if err.Error() != "invalid incident: "+strings.Join(tt.want, "; ") {
+				t.Errorf("Error() = %q", err)
+			}
+		})
+	}
+}
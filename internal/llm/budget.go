@@ -0,0 +1,235 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMaxInputTokens = 16384
+	// heuristicBytesPerToken undercounts typical English (~4 bytes/token) so
+	// the estimate errs on the side of leaving room in the context window.
+	heuristicBytesPerToken = 3
+	evidenceHeaderTokens   = 32
+)
+
+// Tokenizer estimates how many tokens a model will see for text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+type TokenizerFunc func(text string) int
+
+func (f TokenizerFunc) CountTokens(text string) int {
+	return f(text)
+}
+
+// HeuristicTokenizer is the fallback used when no tokenizer is registered for
+// a model.
+var HeuristicTokenizer Tokenizer = TokenizerFunc(func(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len(text) + heuristicBytesPerToken - 1) / heuristicBytesPerToken
+})
+
+var (
+	tokenizersMu sync.RWMutex
+	tokenizers   = map[string]Tokenizer{}
+)
+
+// RegisterTokenizer installs a tokenizer for every model whose name starts
+// with prefix (case-insensitive). The longest matching prefix wins.
+func RegisterTokenizer(prefix string, tokenizer Tokenizer) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" || tokenizer == nil {
+		return
+	}
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+	tokenizers[prefix] = tokenizer
+}
+
+func TokenizerFor(model string) Tokenizer {
+	model = strings.ToLower(strings.TrimSpace(model))
+	tokenizersMu.RLock()
+	defer tokenizersMu.RUnlock()
+	best := ""
+	for prefix := range tokenizers {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return HeuristicTokenizer
+	}
+	return tokenizers[best]
+}
+
+// Budget bounds the prompt sent to a model. The system prompt and incident
+// metadata are charged first; the remainder is split evenly across evidence
+// items, small items handing their unused share to larger ones and earlier
+// (higher priority) items taking any leftover first.
+type Budget struct {
+	MaxTokens int
+	MaxBytes  int
+	Tokenizer Tokenizer
+}
+
+func newBudget(settings Settings, model string) Budget {
+	maxTokens := settings.MaxInputTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultMaxInputTokens
+	}
+	return Budget{
+		MaxTokens: maxTokens,
+		MaxBytes:  settings.MaxInputBytes,
+		Tokenizer: TokenizerFor(model),
+	}
+}
+
+func (b Budget) count(text string) int {
+	if b.Tokenizer == nil {
+		return HeuristicTokenizer.CountTokens(text)
+	}
+	return b.Tokenizer.CountTokens(text)
+}
+
+// Fit returns a copy of input whose evidence fits in what remains of the
+// budget after system and metadata, trimming each item on line boundaries.
+func (b Budget) Fit(system, metadata string, input Input) Input {
+	remaining := b.MaxTokens - b.count(system) - b.count(metadata)
+	out := input
+	out.Evidence = make([]EvidenceText, len(input.Evidence))
+	copy(out.Evidence, input.Evidence)
+	if len(out.Evidence) == 0 {
+		return out
+	}
+	remaining -= evidenceHeaderTokens * len(out.Evidence)
+	if remaining < 0 {
+		remaining = 0
+	}
+	needs := make([]int, len(out.Evidence))
+	for i, item := range out.Evidence {
+		needs[i] = b.count(item.Content)
+	}
+	shares := allocate(needs, remaining)
+	for i := range out.Evidence {
+		if needs[i] > shares[i] {
+			out.Evidence[i].Content = trimLines(out.Evidence[i].Content, shares[i], b.count)
+		}
+	}
+	return out
+}
+
+// allocate splits total across needs so that small items get everything they
+// ask for and the rest is divided evenly, earlier items winning remainders.
+func allocate(needs []int, total int) []int {
+	shares := make([]int, len(needs))
+	order := make([]int, len(needs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return needs[order[a]] < needs[order[b]] })
+	for n, idx := range order {
+		left := len(order) - n
+		fair := total / left
+		if needs[idx] > fair {
+			// This item and every larger one get the same fair share; the
+			// remainder of the division goes to earlier items below.
+			for _, rest := range order[n:] {
+				shares[rest] = fair
+			}
+			total -= fair * left
+			break
+		}
+		shares[idx] = needs[idx]
+		total -= needs[idx]
+	}
+	for i := range shares {
+		if total <= 0 {
+			break
+		}
+		if extra := needs[i] - shares[i]; extra > 0 {
+			if extra > total {
+				extra = total
+			}
+			shares[i] += extra
+			total -= extra
+		}
+	}
+	return shares
+}
+
+// trimLines keeps whole leading lines of text while they fit in limit and
+// appends a marker naming how many lines were dropped. A limit too small for
+// the marker keeps a plain prefix of text instead.
+func trimLines(text string, limit int, count func(string) int) string {
+	if count(text) <= limit {
+		return text
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	marker := func(n int) string {
+		return fmt.Sprintf("[truncated %d lines]", n)
+	}
+	full := limit
+	limit -= count(marker(len(lines)) + "\n")
+	if limit <= 0 {
+		return prefixWithin(text, full, count)
+	}
+	var b strings.Builder
+	used := 0
+	kept := 0
+	for _, line := range lines {
+		cost := count(line)
+		if used+cost > limit {
+			break
+		}
+		b.WriteString(line)
+		used += cost
+		kept++
+	}
+	if kept == len(lines) {
+		return text
+	}
+	if kept == 0 && limit > 0 {
+		// A single oversized first line would otherwise leave nothing; keep
+		// as much of it as fits and count it among the truncated lines.
+		b.WriteString(prefixWithin(lines[0], limit, count))
+	}
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString(marker(len(lines) - kept))
+	return b.String()
+}
+
+func prefixWithin(line string, limit int, count func(string) int) string {
+	lo, hi := 0, len(line)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if count(truncateToBytes(line, mid)) <= limit {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return ""
+	}
+	return truncateToBytes(line, lo)
+}
+
+// TrimToBytes trims text to at most maxBytes on line boundaries, appending a
+// "[truncated N lines]" marker when anything was dropped.
+func TrimToBytes(text string, maxBytes int) string {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text
+	}
+	return trimLines(text, maxBytes, func(s string) int { return len(s) })
+}
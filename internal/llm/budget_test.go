@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// byteCount counts one token per byte, so test budgets read as lengths.
+func byteCount(s string) int { return len(s) }
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name  string
+		needs []int
+		total int
+		want  []int
+	}{
+		{"everything fits", []int{10, 20, 30}, 100, []int{10, 20, 30}},
+		{"even split", []int{50, 50}, 60, []int{30, 30}},
+		{"small items hand over their share", []int{100, 5, 100}, 65, []int{30, 5, 30}},
+		{"remainder to earlier items", []int{100, 100, 100}, 10, []int{4, 3, 3}},
+		{"nothing left", []int{10, 10}, 0, []int{0, 0}},
+		{"no evidence", nil, 100, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocate(tt.needs, tt.total)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("allocate(%v, %d) = %v, want %v", tt.needs, tt.total, got, tt.want)
+			}
+			sum := 0
+			for i, share := range got {
+				sum += share
+				if share > tt.needs[i] {
+					t.Errorf("share %d = %d exceeds need %d", i, share, tt.needs[i])
+				}
+			}
+			if sum > tt.total {
+				t.Errorf("shares sum to %d, over the %d budget", sum, tt.total)
+			}
+		})
+	}
+}
+
+func TestTrimLines(t *testing.T) {
+	text := "line one\nline two\nline three\nline four\n"
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{
+			name:  "fits",
+			text:  text,
+			limit: len(text),
+			want:  text,
+		},
+		{
+			name:  "over budget keeps whole leading lines",
+			text:  text,
+			limit: 38,
+			want:  "line one\nline two\n[truncated 2 lines]",
+		},
+		{
+			name:  "single huge line keeps a prefix",
+			text:  strings.Repeat("x", 100),
+			limit: 30,
+			want:  "xxxxxxxxxx\n[truncated 1 lines]",
+		},
+		{
+			name:  "huge first line of several",
+			text:  strings.Repeat("x", 100) + "\nshort\n",
+			limit: 30,
+			want:  "xxxxxxxxxx\n[truncated 2 lines]",
+		},
+		{
+			name:  "limit below the marker",
+			text:  text,
+			limit: 12,
+			want:  "line one\nlin",
+		},
+		{
+			name:  "empty",
+			text:  "",
+			limit: 10,
+			want:  "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trimLines(tt.text, tt.limit, byteCount)
+			if got != tt.want {
+				t.Errorf("trimLines = %q, want %q", got, tt.want)
+			}
+			if len(got) > tt.limit && got != tt.text {
+				t.Errorf("trimmed to %d bytes, over the %d limit", len(got), tt.limit)
+			}
+		})
+	}
+}
+
+func TestTrimToBytesKeepsRunes(t *testing.T) {
+	got := TrimToBytes(strings.Repeat("é", 20), 25)
+	if got != "éé\n[truncated 1 lines]" {
+		t.Errorf("TrimToBytes = %q", got)
+	}
+}
+
+func TestBudgetFit(t *testing.T) {
+	budget := Budget{MaxTokens: 1000, Tokenizer: TokenizerFunc(byteCount)}
+	system, metadata := strings.Repeat("s", 300), strings.Repeat("m", 100)
+	// 1000 - 400 for system and metadata - 2*32 for evidence headers.
+	available := 1000 - 400 - 2*evidenceHeaderTokens
+
+	t.Run("empty evidence", func(t *testing.T) {
+		out := budget.Fit(system, metadata, Input{})
+		if len(out.Evidence) != 0 {
+			t.Errorf("got %d evidence items", len(out.Evidence))
+		}
+	})
+
+	t.Run("under budget is untouched", func(t *testing.T) {
+		in := Input{Evidence: []EvidenceText{{Content: "short\n"}, {Content: "also short\n"}}}
+		out := budget.Fit(system, metadata, in)
+		if out.Evidence[0].Content != "short\n" || out.Evidence[1].Content != "also short\n" {
+			t.Errorf("evidence changed: %q", contents(out.Evidence))
+		}
+	})
+
+	t.Run("over budget", func(t *testing.T) {
+		big := strings.Repeat(strings.Repeat("a", 49)+"\n", 20)
+		in := Input{Evidence: []EvidenceText{{Content: "small\n"}, {Content: big}}}
+		out := budget.Fit(system, metadata, in)
+		if out.Evidence[0].Content != "small\n" {
+			t.Errorf("small item trimmed to %q", out.Evidence[0].Content)
+		}
+		trimmed := out.Evidence[1].Content
+		if len(trimmed) > available-len("small\n") || !strings.HasSuffix(trimmed, "[truncated 10 lines]") {
+			t.Errorf("big item = %d bytes ending %q, want at most %d", len(trimmed), trimmed[len(trimmed)-25:], available-6)
+		}
+		if in.Evidence[1].Content != big {
+			t.Error("Fit modified the caller's evidence")
+		}
+	})
+
+	t.Run("system prompt uses the whole budget", func(t *testing.T) {
+		in := Input{Evidence: []EvidenceText{{Content: "one line\n"}}}
+		out := budget.Fit(strings.Repeat("s", 2000), metadata, in)
+		if out.Evidence[0].Content != "" {
+			t.Errorf("evidence = %q, want nothing left", out.Evidence[0].Content)
+		}
+	})
+}
+
+func TestTokenizerFor(t *testing.T) {
+	exact := TokenizerFunc(func(string) int { return 1 })
+	longer := TokenizerFunc(func(string) int { return 2 })
+	RegisterTokenizer("test-model", exact)
+	RegisterTokenizer("Test-Model-Large", longer)
+	if got := TokenizerFor("test-model-small").CountTokens("x"); got != 1 {
+		t.Errorf("test-model-small used tokenizer %d, want the test-model prefix", got)
+	}
+	if got := TokenizerFor("test-model-large-2").CountTokens("x"); got != 2 {
+		t.Errorf("test-model-large-2 used tokenizer %d, want the longest prefix", got)
+	}
+	if got := TokenizerFor("other").CountTokens("abcdef"); got != 2 {
+		t.Errorf("unregistered model counted %d tokens, want the heuristic's 2", got)
+	}
+}
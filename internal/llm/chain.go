@@ -0,0 +1,267 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const (
+	defaultRetryAttempts    = 1
+	defaultRetryBackoff     = 500 * time.Millisecond
+	maxRetryBackoff         = 10 * time.Second
+	defaultBreakerThreshold = 3
+	defaultBreakerCooldown  = time.Minute
+	// maxAttemptTimeout caps one provider call when ctx has no deadline.
+	maxAttemptTimeout = 120 * time.Second
+)
+
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+type BreakerSettings struct {
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// Summarizer runs the providers listed in Settings.Provider (comma separated)
+// in order, retrying each one and skipping providers whose circuit breaker is
+// open. It keeps breaker state between calls, so build one per process.
+type Summarizer struct {
+	settings Settings
+	chain    []string
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+func NewSummarizer(settings Settings) *Summarizer {
+	return &Summarizer{
+		settings: settings,
+		chain:    ProviderChain(settings.Provider),
+		breakers: map[string]*breaker{},
+	}
+}
+
+// ProviderChain splits an LLM_PROVIDER value into provider names, defaulting
+// to mock when empty.
+func ProviderChain(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if name := normalizeProviderName(part); name != "" {
+			out = append(out, name)
+		}
+	}
+	if len(out) == 0 {
+		out = []string{"mock"}
+	}
+	return out
+}
+
+func (s *Summarizer) Summarize(ctx context.Context, input Input, redactionLevel string) (types.Summary, error) {
+	return s.summarize(ctx, input, redactionLevel, true)
+}
+
+func (s *Summarizer) summarize(ctx context.Context, input Input, redactionLevel string, verify bool) (types.Summary, error) {
+	if redacted(redactionLevel) {
+		return SummarizeMock(input, redactionLevel), nil
+	}
+	var attempts []types.ProviderAttempt
+	// retryable is set when any provider failed in a way a later run may
+	// get past, so the job is only failed permanently when none did.
+	retryable := false
+	for i, name := range s.chain {
+		if err := ctx.Err(); err != nil {
+			return types.Summary{}, err
+		}
+		record := types.ProviderAttempt{Provider: name}
+		if !s.allow(name) {
+			record.Skipped = true
+			record.Error = "circuit open"
+			attempts = append(attempts, record)
+			retryable = true
+			continue
+		}
+		settings := s.settings
+		settings.Provider = name
+		provider, err := NewProvider(settings)
+		if err != nil {
+			record.Error = err.Error()
+			attempts = append(attempts, record)
+			continue
+		}
+		summary, tries, err := s.try(ctx, provider, input, len(s.chain)-i-1)
+		record.Attempts = tries
+		if err != nil {
+			s.recordFailure(name)
+			record.Error = err.Error()
+			attempts = append(attempts, record)
+			if ctx.Err() != nil {
+				return types.Summary{}, err
+			}
+			if failure.Classify(err).Retryable() {
+				retryable = true
+			}
+			continue
+		}
+		s.recordSuccess(name)
+		attempts = append(attempts, record)
+		summary.Attempts = attempts
+		if verify {
+			VerifyCitations(&summary, input.Evidence)
+		}
+		return summary, nil
+	}
+	return types.Summary{}, chainError(attempts, retryable)
+}
+
+// try calls provider up to its retry policy's attempts. Each attempt gets an
+// even share of the time left before ctx's deadline, counting the attempts
+// still to make here plus one for each of the fallbacks later providers in
+// the chain, so a hung provider cannot use up the whole job.
+func (s *Summarizer) try(ctx context.Context, provider Provider, input Input, fallbacks int) (types.Summary, int, error) {
+	policy := s.retryPolicy(provider.Name())
+	var lastErr error
+	for attempt := 1; attempt <= policy.Attempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout(ctx, policy.Attempts-attempt+1+fallbacks))
+		summary, err := provider.Summarize(attemptCtx, input)
+		cancel()
+		if err == nil {
+			return summary, attempt, nil
+		}
+		lastErr = err
+		if attempt == policy.Attempts || ctx.Err() != nil || !failure.Classify(err).Retryable() {
+			return types.Summary{}, attempt, lastErr
+		}
+		delay := policy.Backoff << (attempt - 1)
+		if delay <= 0 || delay > maxRetryBackoff {
+			delay = maxRetryBackoff
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return types.Summary{}, attempt, lastErr
+		case <-timer.C:
+		}
+	}
+	return types.Summary{}, policy.Attempts, lastErr
+}
+
+func attemptTimeout(ctx context.Context, shares int) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return maxAttemptTimeout
+	}
+	timeout := time.Until(deadline) / time.Duration(shares)
+	if timeout > maxAttemptTimeout {
+		timeout = maxAttemptTimeout
+	}
+	return timeout
+}
+
+func (s *Summarizer) retryPolicy(name string) RetryPolicy {
+	policy := s.settings.Retry
+	if override, ok := s.settings.ProviderRetry[name]; ok {
+		if override.Attempts > 0 {
+			policy.Attempts = override.Attempts
+		}
+		if override.Backoff > 0 {
+			policy.Backoff = override.Backoff
+		}
+	}
+	if policy.Attempts <= 0 {
+		policy.Attempts = defaultRetryAttempts
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+	return policy
+}
+
+func (s *Summarizer) breakerSettings() BreakerSettings {
+	cfg := s.settings.Breaker
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaultBreakerThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultBreakerCooldown
+	}
+	return cfg
+}
+
+// allow reports whether name may be called. Once the cooldown has elapsed the
+// breaker is half-open: one call goes through (the window is pushed out so
+// concurrent jobs keep skipping) and its outcome closes or re-opens it.
+func (s *Summarizer) allow(name string) bool {
+	cfg := s.breakerSettings()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[name]
+	if !ok || b.openUntil.IsZero() {
+		return true
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(cfg.Cooldown)
+	return true
+}
+
+func (s *Summarizer) recordFailure(name string) {
+	cfg := s.breakerSettings()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[name]
+	if !ok {
+		b = &breaker{}
+		s.breakers[name] = b
+	}
+	b.failures++
+	if b.failures >= cfg.Threshold {
+		b.openUntil = time.Now().Add(cfg.Cooldown)
+	}
+}
+
+func (s *Summarizer) recordSuccess(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.breakers, name)
+}
+
+func redacted(level string) bool {
+	level = strings.ToLower(strings.TrimSpace(level))
+	return level != "" && level != "none"
+}
+
+// chainError reports every provider's failure, as a transient failure when
+// retryable and a permanent one otherwise (bad credentials, unknown models,
+// missing provider settings).
+func chainError(attempts []types.ProviderAttempt, retryable bool) error {
+	if len(attempts) == 0 {
+		return failure.New(failure.UpstreamPermanent, errors.New("no llm provider configured"))
+	}
+	parts := make([]string, 0, len(attempts))
+	for _, a := range attempts {
+		parts = append(parts, fmt.Sprintf("%s: %s", a.Provider, a.Error))
+	}
+	err := fmt.Errorf("all llm providers failed: %s", strings.Join(parts, "; "))
+	if retryable {
+		return failure.New(failure.UpstreamTransient, err)
+	}
+	return failure.New(failure.UpstreamPermanent, err)
+}
@@ -0,0 +1,299 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+var (
+	errTransient = failure.New(failure.UpstreamTransient, errors.New("503"))
+	errPermanent = failure.New(failure.UpstreamPermanent, errors.New("401"))
+)
+
+// fakeProvider returns the errors in script in turn and succeeds once the
+// script is used up.
+type fakeProvider struct {
+	name   string
+	script []error
+
+	mu        sync.Mutex
+	calls     int
+	at        []time.Time
+	deadlines []time.Duration
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Summarize(ctx context.Context, _ Input) (types.Summary, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.at = append(p.at, time.Now())
+	if deadline, ok := ctx.Deadline(); ok {
+		p.deadlines = append(p.deadlines, time.Until(deadline))
+	}
+	call := p.calls
+	p.calls++
+	if call < len(p.script) {
+		return types.Summary{}, p.script[call]
+	}
+	return types.Summary{Model: p.name, SummaryMarkdown: "ok"}, nil
+}
+
+// fakes holds the providers the "fake-a" and "fake-b" factories return.
+var fakes = map[string]*fakeProvider{}
+
+func init() {
+	for _, name := range []string{"fake-a", "fake-b"} {
+		Register(name, func(Settings) (Provider, error) { return fakes[name], nil })
+	}
+}
+
+// newFakeChain installs fakes running scriptA and scriptB and returns a Summarizer
+// over "fake-a,fake-b" with a short backoff.
+func newFakeChain(settings Settings, scriptA, scriptB []error) (*Summarizer, *fakeProvider, *fakeProvider) {
+	a := &fakeProvider{name: "fake-a", script: scriptA}
+	b := &fakeProvider{name: "fake-b", script: scriptB}
+	fakes["fake-a"], fakes["fake-b"] = a, b
+	settings.Provider = "fake-a,fake-b"
+	if settings.Retry.Backoff == 0 {
+		settings.Retry.Backoff = time.Millisecond
+	}
+	return NewSummarizer(settings), a, b
+}
+
+func TestSummarizerFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempts   int
+		scriptA    []error
+		scriptB    []error
+		wantModel  string
+		wantErr    failure.Kind
+		wantCallsA int
+		wantCallsB int
+	}{
+		{
+			name:       "first provider succeeds",
+			attempts:   2,
+			wantModel:  "fake-a",
+			wantCallsA: 1,
+		},
+		{
+			name:       "transient error is retried",
+			attempts:   2,
+			scriptA:    []error{errTransient},
+			wantModel:  "fake-a",
+			wantCallsA: 2,
+		},
+		{
+			name:       "retries used up falls back",
+			attempts:   2,
+			scriptA:    []error{errTransient, errTransient},
+			wantModel:  "fake-b",
+			wantCallsA: 2,
+			wantCallsB: 1,
+		},
+		{
+			name:       "permanent error is not retried",
+			attempts:   3,
+			scriptA:    []error{errPermanent},
+			wantModel:  "fake-b",
+			wantCallsA: 1,
+			wantCallsB: 1,
+		},
+		{
+			name:       "all permanent",
+			attempts:   2,
+			scriptA:    []error{errPermanent},
+			scriptB:    []error{errPermanent},
+			wantErr:    failure.UpstreamPermanent,
+			wantCallsA: 1,
+			wantCallsB: 1,
+		},
+		{
+			name:       "any transient keeps the chain retryable",
+			attempts:   1,
+			scriptA:    []error{errTransient},
+			scriptB:    []error{errPermanent},
+			wantErr:    failure.UpstreamTransient,
+			wantCallsA: 1,
+			wantCallsB: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, a, b := newFakeChain(Settings{Retry: RetryPolicy{Attempts: tt.attempts}}, tt.scriptA, tt.scriptB)
+			summary, err := s.Summarize(context.Background(), Input{}, "")
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("got summary from %s, want %s error", summary.Model, tt.wantErr)
+				}
+				if kind := failure.Classify(err); kind != tt.wantErr {
+					t.Errorf("error kind = %s, want %s (%v)", kind, tt.wantErr, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if summary.Model != tt.wantModel {
+					t.Errorf("model = %s, want %s", summary.Model, tt.wantModel)
+				}
+				if last := summary.Attempts[len(summary.Attempts)-1]; last.Provider != tt.wantModel || last.Error != "" {
+					t.Errorf("last attempt record = %+v", last)
+				}
+			}
+			if a.calls != tt.wantCallsA || b.calls != tt.wantCallsB {
+				t.Errorf("calls = %d, %d, want %d, %d", a.calls, b.calls, tt.wantCallsA, tt.wantCallsB)
+			}
+		})
+	}
+}
+
+func TestSummarizerBackoffDoubles(t *testing.T) {
+	backoff := 20 * time.Millisecond
+	s, a, _ := newFakeChain(Settings{Retry: RetryPolicy{Attempts: 3, Backoff: backoff}}, []error{errTransient, errTransient}, nil)
+	if _, err := s.Summarize(context.Background(), Input{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.at) != 3 {
+		t.Fatalf("got %d calls, want 3", len(a.at))
+	}
+	for i, want := range []time.Duration{backoff, 2 * backoff} {
+		if gap := a.at[i+1].Sub(a.at[i]); gap < want {
+			t.Errorf("gap before attempt %d = %s, want at least %s", i+2, gap, want)
+		}
+	}
+}
+
+func TestSummarizerRetryPolicyOverride(t *testing.T) {
+	s, a, _ := newFakeChain(Settings{
+		Retry:         RetryPolicy{Attempts: 1},
+		ProviderRetry: map[string]RetryPolicy{"fake-a": {Attempts: 3}},
+	}, []error{errTransient, errTransient}, nil)
+	summary, err := s.Summarize(context.Background(), Input{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Model != "fake-a" || a.calls != 3 {
+		t.Errorf("model = %s after %d calls, want fake-a after 3", summary.Model, a.calls)
+	}
+}
+
+func TestSummarizerBreaker(t *testing.T) {
+	cooldown := 50 * time.Millisecond
+	s, a, b := newFakeChain(Settings{
+		Retry:   RetryPolicy{Attempts: 1},
+		Breaker: BreakerSettings{Threshold: 2, Cooldown: cooldown},
+	}, []error{errTransient, errTransient, errTransient}, nil)
+	summarize := func() types.Summary {
+		t.Helper()
+		summary, err := s.Summarize(context.Background(), Input{}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+
+	// Closed: failures below the threshold still call fake-a.
+	summarize()
+	summarize()
+	if a.calls != 2 {
+		t.Fatalf("fake-a calls = %d, want 2 before the breaker opens", a.calls)
+	}
+
+	// Open: fake-a is skipped without a call.
+	summary := summarize()
+	if a.calls != 2 {
+		t.Errorf("fake-a called while its breaker is open")
+	}
+	if first := summary.Attempts[0]; !first.Skipped || first.Error != "circuit open" {
+		t.Errorf("first attempt = %+v, want skipped with circuit open", first)
+	}
+
+	// Half-open: one call goes through and, failing, re-opens the breaker.
+	time.Sleep(cooldown)
+	summarize()
+	if a.calls != 3 {
+		t.Fatalf("fake-a calls = %d, want 3 after the cooldown", a.calls)
+	}
+	summarize()
+	if a.calls != 3 {
+		t.Errorf("fake-a called after a failed half-open probe")
+	}
+
+	// Half-open again: a success closes it.
+	time.Sleep(cooldown)
+	if summary := summarize(); summary.Model != "fake-a" {
+		t.Errorf("half-open probe served by %s, want fake-a", summary.Model)
+	}
+	if summary := summarize(); summary.Model != "fake-a" || a.calls != 5 {
+		t.Errorf("breaker not closed after a success: model %s, %d calls", summary.Model, a.calls)
+	}
+	if b.calls != 5 {
+		t.Errorf("fake-b calls = %d, want 5 (once per failed or skipped fake-a)", b.calls)
+	}
+}
+
+func TestSummarizerHalfOpenAllowsOneProbe(t *testing.T) {
+	s, _, _ := newFakeChain(Settings{Breaker: BreakerSettings{Threshold: 1, Cooldown: 10 * time.Millisecond}}, nil, nil)
+	s.recordFailure("fake-a")
+	if s.allow("fake-a") {
+		t.Fatal("open breaker allowed a call")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !s.allow("fake-a") {
+		t.Fatal("breaker did not half-open after the cooldown")
+	}
+	if s.allow("fake-a") {
+		t.Error("half-open breaker allowed a second concurrent call")
+	}
+}
+
+func TestSummarizerAttemptDeadlines(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		// want is each fake-a attempt's expected deadline.
+		want []time.Duration
+	}{
+		{
+			// Two attempts here plus one fallback share the budget.
+			name:    "split across attempts and fallbacks",
+			timeout: 3 * time.Second,
+			want:    []time.Duration{time.Second, 1500 * time.Millisecond},
+		},
+		{
+			name:    "capped without a short deadline",
+			timeout: time.Hour,
+			want:    []time.Duration{maxAttemptTimeout, maxAttemptTimeout},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, a, _ := newFakeChain(Settings{Retry: RetryPolicy{Attempts: 2}}, []error{errTransient}, nil)
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if _, err := s.Summarize(ctx, Input{}, ""); err != nil {
+				t.Fatal(err)
+			}
+			if len(a.deadlines) != len(tt.want) {
+				t.Fatalf("got %d deadlines, want %d", len(a.deadlines), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := a.deadlines[i]; got > want || got < want-100*time.Millisecond {
+					t.Errorf("attempt %d deadline = %s, want about %s", i+1, got, want)
+				}
+			}
+		})
+	}
+
+	if got := attemptTimeout(context.Background(), 3); got != maxAttemptTimeout {
+		t.Errorf("attempt timeout without a deadline = %s, want %s", got, maxAttemptTimeout)
+	}
+}
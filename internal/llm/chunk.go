@@ -0,0 +1,212 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const (
+	maxReduceRounds         = 4
+	defaultChunkConcurrency = 4
+)
+
+// ChunkEvidence splits evidence into pieces of at most maxBytes, breaking on
+// line boundaries where possible. Items that already fit are returned as-is.
+func ChunkEvidence(items []EvidenceText, maxBytes int) []EvidenceText {
+	if maxBytes <= 0 {
+		return items
+	}
+	var out []EvidenceText
+	for _, item := range items {
+		if len(item.Content) <= maxBytes {
+			out = append(out, item)
+			continue
+		}
+		parts := splitLines(item.Content, maxBytes)
+		offset := item.Offset
+		for i, part := range parts {
+			chunk := item
+			chunk.Title = fmt.Sprintf("%s (part %d/%d)", item.Title, i+1, len(parts))
+			chunk.Content = part
+			chunk.Offset = offset
+			offset += len(part)
+			out = append(out, chunk)
+		}
+	}
+	return out
+}
+
+func splitLines(content string, maxBytes int) []string {
+	var parts []string
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			parts = append(parts, b.String())
+			b.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		for len(line) > maxBytes {
+			flush()
+			head := truncateToBytes(line, maxBytes)
+			if head == "" {
+				head = line[:maxBytes]
+			}
+			parts = append(parts, head)
+			line = line[len(head):]
+		}
+		if b.Len()+len(line) > maxBytes {
+			flush()
+		}
+		b.WriteString(line)
+	}
+	flush()
+	return parts
+}
+
+// SummarizeChunked summarizes each evidence chunk separately (map) and then
+// merges the partial summaries (reduce), repeating the reduce step while the
+// partials still do not fit in a single chunk. Map calls, and the batches of
+// each reduce round, run Settings.ChunkConcurrency at a time, so the calls
+// made in sequence number ceil(chunks/concurrency) plus at most
+// maxReduceRounds; ctx's deadline bounds the whole job.
+func (s *Summarizer) SummarizeChunked(ctx context.Context, input Input, chunkBytes int, redactionLevel string) (types.Summary, error) {
+	if chunkBytes <= 0 || redacted(redactionLevel) {
+		return s.Summarize(ctx, input, redactionLevel)
+	}
+	chunks := ChunkEvidence(input.Evidence, chunkBytes)
+	if len(chunks) <= 1 {
+		return s.Summarize(ctx, Input{Bundle: input.Bundle, Template: input.Template, Evidence: chunks}, redactionLevel)
+	}
+	inputs := make([]Input, len(chunks))
+	for i, chunk := range chunks {
+		inputs[i] = Input{Bundle: input.Bundle, Template: input.Template, Evidence: []EvidenceText{chunk}}
+	}
+	summaries, failed, err := s.summarizeEach(ctx, inputs, redactionLevel, true)
+	if err != nil {
+		return types.Summary{}, fmt.Errorf("summarize chunk %d/%d: %w", failed+1, len(chunks), err)
+	}
+	partials := make([]EvidenceText, 0, len(chunks))
+	var citations []types.Citation
+	for i, summary := range summaries {
+		citations = append(citations, summary.Citations...)
+		partials = append(partials, partialEvidence(chunks[i].Title, chunks[i].ArtifactPtr, summary))
+	}
+	// Reduce passes only see partial summaries, so their quotes cannot be
+	// checked against evidence; the final summary carries the map citations.
+	for round := 1; ; round++ {
+		batches := batchEvidence(partials, chunkBytes)
+		if len(batches) == 1 || round >= maxReduceRounds {
+			summary, err := s.summarize(ctx, Input{Bundle: input.Bundle, Template: input.Template, Evidence: partials}, redactionLevel, false)
+			if err != nil {
+				return types.Summary{}, err
+			}
+			summary.Citations = citations
+			VerifyCitations(&summary, chunks)
+			return summary, nil
+		}
+		inputs := make([]Input, len(batches))
+		for i, batch := range batches {
+			inputs[i] = Input{Bundle: input.Bundle, Template: input.Template, Evidence: batch}
+		}
+		summaries, failed, err := s.summarizeEach(ctx, inputs, redactionLevel, false)
+		if err != nil {
+			return types.Summary{}, fmt.Errorf("reduce round %d batch %d/%d: %w", round, failed+1, len(batches), err)
+		}
+		next := make([]EvidenceText, 0, len(batches))
+		for i, summary := range summaries {
+			next = append(next, partialEvidence(fmt.Sprintf("batch %d/%d", i+1, len(batches)), "", summary))
+		}
+		partials = next
+	}
+}
+
+// summarizeEach summarizes inputs with at most ChunkConcurrency calls in
+// flight. On failure it cancels the calls still running and returns the
+// index of the input that failed first.
+func (s *Summarizer) summarizeEach(ctx context.Context, inputs []Input, redactionLevel string, verify bool) ([]types.Summary, int, error) {
+	limit := s.settings.ChunkConcurrency
+	if limit <= 0 {
+		limit = defaultChunkConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	summaries := make([]types.Summary, len(inputs))
+	sem := make(chan struct{}, limit)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		failed   int
+		firstErr error
+	)
+	for i, in := range inputs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			once.Do(func() { failed, firstErr = i, err })
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			summary, err := s.summarize(ctx, in, redactionLevel, verify)
+			if err != nil {
+				once.Do(func() {
+					failed, firstErr = i, err
+					cancel()
+				})
+				return
+			}
+			summaries[i] = summary
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, failed, firstErr
+	}
+	return summaries, 0, nil
+}
+
+func partialEvidence(title, artifactPtr string, summary types.Summary) EvidenceText {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(summary.SummaryMarkdown))
+	if len(summary.Highlights) > 0 {
+		b.WriteString("\nHighlights:\n- " + strings.Join(summary.Highlights, "\n- "))
+	}
+	if len(summary.ActionItems) > 0 {
+		b.WriteString("\nAction items:\n- " + strings.Join(summary.ActionItems, "\n- "))
+	}
+	return EvidenceText{
+		Kind:        "partial_summary",
+		Title:       "partial summary of " + title,
+		ArtifactPtr: artifactPtr,
+		ContentType: "text/markdown",
+		Content:     b.String(),
+	}
+}
+
+func batchEvidence(items []EvidenceText, maxBytes int) [][]EvidenceText {
+	var batches [][]EvidenceText
+	var current []EvidenceText
+	size := 0
+	for _, item := range items {
+		if len(current) > 0 && size+len(item.Content) > maxBytes {
+			batches = append(batches, current)
+			current = nil
+			size = 0
+		}
+		current = append(current, item)
+		size += len(item.Content)
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
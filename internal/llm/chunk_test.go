@@ -0,0 +1,277 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+func TestChunkEvidence(t *testing.T) {
+	lines := "alpha 1\nbravo 2\ncharlie 3\ndelta 4\n"
+	tests := []struct {
+		name     string
+		content  string
+		maxBytes int
+		want     []string
+	}{
+		{
+			name:     "fits",
+			content:  lines,
+			maxBytes: len(lines),
+			want:     []string{lines},
+		},
+		{
+			name:     "breaks on lines",
+			content:  lines,
+			maxBytes: 18,
+			want:     []string{"alpha 1\nbravo 2\n", "charlie 3\ndelta 4\n"},
+		},
+		{
+			name:     "long line is cut",
+			content:  "short\n" + strings.Repeat("x", 12) + "\nend",
+			maxBytes: 5,
+			want:     []string{"short", "\n", "xxxxx", "xxxxx", "xx\n", "end"},
+		},
+		{
+			name:     "cut keeps runes whole",
+			content:  "ééé",
+			maxBytes: 3,
+			want:     []string{"é", "é", "é"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := EvidenceText{Kind: "log", Title: "app.log", ArtifactPtr: "artifact://1", Content: tt.content}
+			chunks := ChunkEvidence([]EvidenceText{item}, tt.maxBytes)
+			if len(chunks) != len(tt.want) {
+				t.Fatalf("got %d chunks %q, want %d", len(chunks), contents(chunks), len(tt.want))
+			}
+			offset := 0
+			for i, chunk := range chunks {
+				if chunk.Content != tt.want[i] {
+					t.Errorf("chunk %d = %q, want %q", i, chunk.Content, tt.want[i])
+				}
+				if len(chunk.Content) > tt.maxBytes || !utf8.ValidString(chunk.Content) {
+					t.Errorf("chunk %d %q exceeds %d bytes or splits a rune", i, chunk.Content, tt.maxBytes)
+				}
+				if chunk.Offset != offset {
+					t.Errorf("chunk %d offset = %d, want %d", i, chunk.Offset, offset)
+				}
+				offset += len(chunk.Content)
+				if chunk.ArtifactPtr != item.ArtifactPtr {
+					t.Errorf("chunk %d lost its artifact pointer", i)
+				}
+				if len(chunks) > 1 && !strings.HasSuffix(chunk.Title, ")") {
+					t.Errorf("chunk %d title %q has no part number", i, chunk.Title)
+				}
+			}
+			if strings.Join(contents(chunks), "") != tt.content {
+				t.Error("chunks do not reassemble the evidence")
+			}
+		})
+	}
+}
+
+func contents(items []EvidenceText) []string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = item.Content
+	}
+	return out
+}
+
+// chunkProvider summarizes each input as "<n> item(s)" padded to
+// summaryBytes, so the size of the partials, and with it the number of
+// reduce rounds, is fixed by the test. Inputs whose evidence contains "FAIL"
+// fail permanently. It records the inputs it saw and the most calls it had
+// in flight at once.
+type chunkProvider struct {
+	summaryBytes int
+	delay        time.Duration
+
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+
+	mu        sync.Mutex
+	inputs    []Input
+	cancelled int
+}
+
+var chunkFake *chunkProvider
+
+func init() {
+	Register("fake-chunk", func(Settings) (Provider, error) { return chunkFake, nil })
+}
+
+func (p *chunkProvider) Name() string { return "fake-chunk" }
+
+func (p *chunkProvider) Summarize(ctx context.Context, input Input) (types.Summary, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		max := p.maxInFlight.Load()
+		if n <= max || p.maxInFlight.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	p.mu.Lock()
+	p.inputs = append(p.inputs, input)
+	p.mu.Unlock()
+
+	for _, item := range input.Evidence {
+		if strings.Contains(item.Content, "FAIL") {
+			return types.Summary{}, failure.New(failure.UpstreamPermanent, errors.New("bad chunk"))
+		}
+	}
+	select {
+	case <-time.After(p.delay):
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.cancelled++
+		p.mu.Unlock()
+		return types.Summary{}, ctx.Err()
+	}
+	text := fmt.Sprintf("%d item(s)", len(input.Evidence))
+	if pad := p.summaryBytes - len(text); pad > 0 {
+		text += strings.Repeat(".", pad)
+	}
+	return types.Summary{SummaryMarkdown: text, Model: "fake-chunk"}, nil
+}
+
+func newChunkSummarizer(concurrency, summaryBytes int, delay time.Duration) (*Summarizer, *chunkProvider) {
+	chunkFake = &chunkProvider{summaryBytes: summaryBytes, delay: delay}
+	return NewSummarizer(Settings{Provider: "fake-chunk", ChunkConcurrency: concurrency}), chunkFake
+}
+
+// logEvidence is one log item of n lines, each width bytes long, so a
+// chunk of width bytes holds exactly one line.
+func logEvidence(n, width int) Input {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(strings.Repeat(string(rune('a'+i%26)), width-1) + "\n")
+	}
+	return Input{Evidence: []EvidenceText{{Kind: "log", Title: "app.log", ArtifactPtr: "artifact://1", Content: b.String()}}}
+}
+
+// callSizes is the number of evidence items in each call p received.
+func (p *chunkProvider) callSizes() []int {
+	sizes := make([]int, len(p.inputs))
+	for i, in := range p.inputs {
+		sizes[i] = len(in.Evidence)
+	}
+	return sizes
+}
+
+func TestSummarizeChunked(t *testing.T) {
+	tests := []struct {
+		name         string
+		lines        int
+		chunkBytes   int
+		summaryBytes int
+		// calls is the number of evidence items in each provider call:
+		// the map calls, each reduce round's batches, then the final merge.
+		calls []int
+	}{
+		{
+			name:       "fits one chunk",
+			lines:      3,
+			chunkBytes: 400,
+			calls:      []int{1},
+		},
+		{
+			name:         "one reduce",
+			lines:        3,
+			chunkBytes:   40,
+			summaryBytes: 10,
+			calls:        []int{1, 1, 1, 3},
+		},
+		{
+			name:         "reduce rounds until the partials fit",
+			lines:        6,
+			chunkBytes:   40,
+			summaryBytes: 15,
+			calls:        []int{1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 1, 2},
+		},
+		{
+			name:         "final merge after maxReduceRounds",
+			lines:        2,
+			chunkBytes:   40,
+			summaryBytes: 50,
+			calls:        []int{1, 1, 1, 1, 1, 1, 1, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, p := newChunkSummarizer(1, tt.summaryBytes, 0)
+			summary, err := s.SummarizeChunked(context.Background(), logEvidence(tt.lines, 40), tt.chunkBytes, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.callSizes(); fmt.Sprint(got) != fmt.Sprint(tt.calls) {
+				t.Errorf("calls = %v, want %v", got, tt.calls)
+			}
+			final := tt.calls[len(tt.calls)-1]
+			if !strings.HasPrefix(summary.SummaryMarkdown, fmt.Sprintf("%d item(s)", final)) {
+				t.Errorf("summary = %q, want the final merge of %d", summary.SummaryMarkdown, final)
+			}
+		})
+	}
+}
+
+func TestSummarizeChunkedPartialsInOrder(t *testing.T) {
+	s, p := newChunkSummarizer(3, 10, 0)
+	if _, err := s.SummarizeChunked(context.Background(), logEvidence(3, 40), 40, ""); err != nil {
+		t.Fatal(err)
+	}
+	final := p.inputs[len(p.inputs)-1]
+	for i, item := range final.Evidence {
+		want := fmt.Sprintf("partial summary of app.log (part %d/3)", i+1)
+		if item.Title != want || item.ArtifactPtr != "artifact://1" || item.Kind != "partial_summary" {
+			t.Errorf("partial %d = %q (%s, %s), want %q", i, item.Title, item.Kind, item.ArtifactPtr, want)
+		}
+	}
+}
+
+func TestSummarizeChunkedConcurrency(t *testing.T) {
+	s, p := newChunkSummarizer(2, 10, 20*time.Millisecond)
+	if _, err := s.SummarizeChunked(context.Background(), logEvidence(6, 40), 40, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.maxInFlight.Load(); got != 2 {
+		t.Errorf("max calls in flight = %d, want ChunkConcurrency 2", got)
+	}
+}
+
+func TestSummarizeChunkedFailureCancelsPeers(t *testing.T) {
+	s, p := newChunkSummarizer(3, 10, time.Second)
+	input := logEvidence(8, 40)
+	lines := strings.SplitAfter(input.Evidence[0].Content, "\n")
+	lines[2] = strings.Repeat("F", 35) + "FAIL\n"
+	input.Evidence[0].Content = strings.Join(lines, "")
+
+	start := time.Now()
+	_, err := s.SummarizeChunked(context.Background(), input, 40, "")
+	if err == nil || !strings.Contains(err.Error(), "summarize chunk 3/8") {
+		t.Fatalf("err = %v, want chunk 3/8 to fail", err)
+	}
+	if kind := failure.Classify(err); kind != failure.UpstreamPermanent {
+		t.Errorf("kind = %s, want the chunk's upstream_permanent", kind)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %s: calls in flight were not cancelled", elapsed)
+	}
+	// Peers may not have reached the provider before the failure, but
+	// none past the first three start and those that did are cancelled.
+	if len(p.inputs) > 3 || p.cancelled != len(p.inputs)-1 {
+		t.Errorf("%d calls made, %d cancelled; want at most 3, all but the failure cancelled", len(p.inputs), p.cancelled)
+	}
+}
@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// uncitedConfidenceFactor scales confidence when a summary built from
+// evidence carries no verified citation at all.
+const uncitedConfidenceFactor = 0.5
+
+func citationsFromPayload(raw []citationPayload, evidence []EvidenceText) []types.Citation {
+	var out []types.Citation
+	for _, c := range raw {
+		quote := strings.TrimSpace(c.Quote)
+		if quote == "" {
+			continue
+		}
+		citation := types.Citation{Quote: quote}
+		if c.Evidence >= 1 && c.Evidence <= len(evidence) {
+			citation.ArtifactPtr = evidence[c.Evidence-1].ArtifactPtr
+		}
+		out = append(out, citation)
+	}
+	return out
+}
+
+// VerifyCitations checks every citation against the evidence text the model
+// was shown, filling in the artifact pointer and byte offset for quotes that
+// are found and flagging the rest as unverified. Confidence is scaled by the
+// share of verified citations, and halved when nothing was cited.
+func VerifyCitations(summary *types.Summary, evidence []EvidenceText) {
+	if summary == nil || len(evidence) == 0 {
+		return
+	}
+	verified := 0
+	for i := range summary.Citations {
+		c := &summary.Citations[i]
+		c.Verified = false
+		c.Offset = 0
+		for _, item := range evidence {
+			if c.ArtifactPtr != "" && item.ArtifactPtr != c.ArtifactPtr {
+				continue
+			}
+			if offset, ok := findQuote(item.Content, c.Quote); ok {
+				c.ArtifactPtr = item.ArtifactPtr
+				c.Offset = item.Offset + offset
+				c.Verified = true
+				break
+			}
+		}
+		if c.Verified {
+			verified++
+		}
+	}
+	factor := uncitedConfidenceFactor
+	if total := len(summary.Citations); total > 0 {
+		factor = uncitedConfidenceFactor + (1-uncitedConfidenceFactor)*float64(verified)/float64(total)
+	}
+	summary.Confidence = math.Round(summary.Confidence*factor*100) / 100
+}
+
+// findQuote locates quote in content, first verbatim and then ignoring case
+// and differences in whitespace runs, returning the byte offset into content.
+func findQuote(content, quote string) (int, bool) {
+	quote = strings.Trim(quote, "\"'`“”… ")
+	if quote == "" {
+		return 0, false
+	}
+	if idx := strings.Index(content, quote); idx >= 0 {
+		return idx, true
+	}
+	normContent, offsets := foldText(content)
+	normQuote, _ := foldText(quote)
+	normQuote = strings.TrimSpace(normQuote)
+	if normQuote == "" {
+		return 0, false
+	}
+	if idx := strings.Index(normContent, normQuote); idx >= 0 {
+		return offsets[idx], true
+	}
+	return 0, false
+}
+
+// foldText lowercases value and replaces each run of whitespace with a
+// single space, returning, for every byte of the result, its offset in the
+// original string.
+func foldText(value string) (string, []int) {
+	var b strings.Builder
+	offsets := make([]int, 0, len(value))
+	inSpace := false
+	for i, r := range value {
+		if unicode.IsSpace(r) {
+			if inSpace {
+				continue
+			}
+			inSpace = true
+			b.WriteByte(' ')
+			offsets = append(offsets, i)
+			continue
+		}
+		inSpace = false
+		n, _ := b.WriteRune(unicode.ToLower(r))
+		for j := 0; j < n; j++ {
+			offsets = append(offsets, i+j)
+		}
+	}
+	return b.String(), offsets
+}
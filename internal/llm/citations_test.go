@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+func TestFindQuote(t *testing.T) {
+	content := "2024-05-01 ERROR  payment-api:\n\tconnection refused to db-1:5432\nretrying in 5s"
+	tests := []struct {
+		name   string
+		quote  string
+		offset int
+		found  bool
+	}{
+		{"verbatim", "connection refused to db-1:5432", 32, true},
+		{"surrounding quotes", "“retrying in 5s”", 64, true},
+		{"collapsed whitespace", "ERROR payment-api: connection refused", 11, true},
+		{"different case", "error Payment-API:", 11, true},
+		{"case and line break", "PAYMENT-API: CONNECTION", 18, true},
+		{"not in evidence", "connection reset by peer", 0, false},
+		{"paraphrase", "the database refused connections", 0, false},
+		{"only quote marks", "\"\"", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, found := findQuote(content, tt.quote)
+			if found != tt.found || offset != tt.offset {
+				t.Errorf("findQuote(%q) = %d, %t, want %d, %t", tt.quote, offset, found, tt.offset, tt.found)
+			}
+		})
+	}
+}
+
+func TestFindQuoteOffsetAfterMultibyteRunes(t *testing.T) {
+	content := "Zürich  DB: TIMEOUT"
+	offset, ok := findQuote(content, "db: timeout")
+	if !ok || content[offset:offset+3] != "DB:" {
+		t.Errorf("findQuote = %d, %t, want the offset of %q", offset, ok, "DB:")
+	}
+}
+
+func TestVerifyCitations(t *testing.T) {
+	evidence := []EvidenceText{
+		{ArtifactPtr: "artifact://logs", Content: "disk full on /var\nwrites failing"},
+		{ArtifactPtr: "artifact://logs", Offset: 100, Content: "second chunk: OOM killed"},
+		{ArtifactPtr: "artifact://alert", Content: "Alert: Disk usage 98%"},
+	}
+	// Each case starts from a confidence of 0.8.
+	tests := []struct {
+		name       string
+		citations  []types.Citation
+		want       []types.Citation
+		confidence float64
+	}{
+		{
+			name:      "all verified keeps confidence",
+			citations: []types.Citation{{Quote: "writes failing"}, {Quote: "disk usage 98%"}},
+			want: []types.Citation{
+				{ArtifactPtr: "artifact://logs", Quote: "writes failing", Offset: 18, Verified: true},
+				{ArtifactPtr: "artifact://alert", Quote: "disk usage 98%", Offset: 7, Verified: true},
+			},
+			confidence: 0.8,
+		},
+		{
+			name:       "offset within a later chunk",
+			citations:  []types.Citation{{Quote: "OOM killed"}},
+			want:       []types.Citation{{ArtifactPtr: "artifact://logs", Quote: "OOM killed", Offset: 114, Verified: true}},
+			confidence: 0.8,
+		},
+		{
+			name:       "pointer restricts the search",
+			citations:  []types.Citation{{ArtifactPtr: "artifact://alert", Quote: "writes failing"}},
+			want:       []types.Citation{{ArtifactPtr: "artifact://alert", Quote: "writes failing"}},
+			confidence: 0.4,
+		},
+		{
+			name:      "half unverified scales confidence",
+			citations: []types.Citation{{Quote: "disk full"}, {Quote: "kernel panic", Offset: 9, Verified: true}},
+			want: []types.Citation{
+				{ArtifactPtr: "artifact://logs", Quote: "disk full", Verified: true},
+				{Quote: "kernel panic"},
+			},
+			confidence: 0.6,
+		},
+		{
+			name:       "no citations halves confidence",
+			confidence: 0.4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := types.Summary{Citations: tt.citations, Confidence: 0.8}
+			VerifyCitations(&summary, evidence)
+			if len(summary.Citations) != len(tt.want) {
+				t.Fatalf("got %d citations, want %d", len(summary.Citations), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if summary.Citations[i] != want {
+					t.Errorf("citation %d = %+v, want %+v", i, summary.Citations[i], want)
+				}
+			}
+			if summary.Confidence != tt.confidence {
+				t.Errorf("confidence = %v, want %v", summary.Confidence, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestCitationsFromPayload(t *testing.T) {
+	evidence := []EvidenceText{{ArtifactPtr: "artifact://a"}, {ArtifactPtr: "artifact://b"}}
+	got := citationsFromPayload([]citationPayload{
+		{Evidence: 2, Quote: "  quoted  "},
+		{Evidence: 7, Quote: "out of range"},
+		{Evidence: 1, Quote: " "},
+	}, evidence)
+	want := []types.Citation{{ArtifactPtr: "artifact://b", Quote: "quoted"}, {Quote: "out of range"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("citations = %+v, want %+v", got, want)
+	}
+}
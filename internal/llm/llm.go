@@ -3,21 +3,43 @@ package llm
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
 )
 
 type Settings struct {
 	Provider       string
-	OpenAIAPIKey   string
-	OpenAIModel    string
-	OllamaURL      string
-	OllamaModel    string
-	OllamaTemp     float64
 	MaxInputBytes  int
+	MaxInputTokens int
 	MaxEvidence    int
 	MaxEvidenceLen int
+	OpenAI         OpenAISettings
+	Ollama         OllamaSettings
+	Retry          RetryPolicy
+	ProviderRetry  map[string]RetryPolicy
+	Breaker        BreakerSettings
+	// ChunkConcurrency caps the provider calls SummarizeChunked makes at
+	// once; 0 means 4.
+	ChunkConcurrency int
+	// Options carries free-form settings for providers registered outside
+	// this package (LLM_OPTION_<NAME> env vars, keyed by lowercased name).
+	Options map[string]string
+}
+
+type OpenAISettings struct {
+	APIKey      string
+	Model       string
+	BaseURL     string
+	Temperature float64
+}
+
+type OllamaSettings struct {
+	URL         string
+	Model       string
+	Temperature float64
 }
 
 type EvidenceText struct {
@@ -26,27 +48,81 @@ type EvidenceText struct {
 	ArtifactPtr string
 	ContentType string
 	Content     string
+	// Offset is the byte offset of Content within the item's full evidence
+	// text; non-zero only for chunks after the first.
+	Offset int
 }
 
 type Input struct {
 	Bundle   types.EvidenceBundle
 	Evidence []EvidenceText
+	// Template overrides the built-in prompts when set.
+	Template *Template
 }
 
-func Summarize(ctx context.Context, settings Settings, input Input, redactionLevel string) (types.Summary, error) {
-	redaction := strings.ToLower(strings.TrimSpace(redactionLevel))
-	if redaction != "" && redaction != "none" {
-		return SummarizeMock(input, redactionLevel), nil
+// Provider produces a summary for a single input. Implementations are
+// constructed per call from Settings by the Factory they were registered with.
+type Provider interface {
+	Name() string
+	Summarize(ctx context.Context, input Input) (types.Summary, error)
+}
+
+type Factory func(settings Settings) (Provider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a provider available under name for LLM_PROVIDER. It panics
+// if the name is empty or already registered, mirroring database/sql drivers.
+func Register(name string, factory Factory) {
+	name = normalizeProviderName(name)
+	if name == "" {
+		panic("llm: register provider with empty name")
+	}
+	if factory == nil {
+		panic("llm: register nil factory for " + name)
 	}
-	provider := strings.ToLower(strings.TrimSpace(settings.Provider))
-	switch provider {
-	case "", "mock":
-		return SummarizeMock(input, redactionLevel), nil
-	case "openai":
-		return SummarizeOpenAI(ctx, settings, input)
-	case "ollama":
-		return SummarizeOllama(ctx, settings, input)
-	default:
-		return types.Summary{}, fmt.Errorf("unsupported llm provider: %s", settings.Provider)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic("llm: provider registered twice: " + name)
 	}
+	registry[name] = factory
+}
+
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewProvider(settings Settings) (Provider, error) {
+	name := normalizeProviderName(settings.Provider)
+	if name == "" {
+		name = "mock"
+	}
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported llm provider: %s", settings.Provider)
+	}
+	return factory(settings)
+}
+
+// Summarize runs the configured provider chain once without keeping circuit
+// breaker state; long-lived callers should hold a Summarizer instead.
+func Summarize(ctx context.Context, settings Settings, input Input, redactionLevel string) (types.Summary, error) {
+	return NewSummarizer(settings).Summarize(ctx, input, redactionLevel)
+}
+
+func normalizeProviderName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
 }
@@ -1,21 +1,36 @@
 package llm
 
 import (
+	"context"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
 )
 
+func init() {
+	Register("mock", func(Settings) (Provider, error) {
+		return mockProvider{}, nil
+	})
+}
+
+type mockProvider struct{}
+
+func (mockProvider) Name() string {
+	return "mock"
+}
+
+func (mockProvider) Summarize(_ context.Context, input Input) (types.Summary, error) {
+	return SummarizeMock(input, ""), nil
+}
+
 func SummarizeMock(input Input, redactionLevel string) types.Summary {
 	summary := types.Summary{
 		IncidentID: input.Bundle.IncidentID,
 		Model:      "mock",
 		Confidence: 0.4,
 	}
-	redaction := strings.ToLower(strings.TrimSpace(redactionLevel))
-	if redaction != "" && redaction != "none" {
+	if redacted(redactionLevel) {
 		summary.SummaryMarkdown = "Summary redacted by policy."
 		summary.Highlights = []string{"redacted"}
 		summary.ActionItems = []string{"request approval to view full details"}
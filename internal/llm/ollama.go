@@ -11,110 +11,159 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
 )
 
-type ollamaMessage struct {
+type chatMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
 
 type ollamaRequest struct {
-	Model    string          `json:"model"`
-	Messages []ollamaMessage `json:"messages"`
-	Stream   bool            `json:"stream"`
-	Format   string          `json:"format,omitempty"`
-	Options  map[string]any  `json:"options,omitempty"`
+	Model    string         `json:"model"`
+	Messages []chatMessage  `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Format   string         `json:"format,omitempty"`
+	Options  map[string]any `json:"options,omitempty"`
 }
 
 type ollamaResponse struct {
-	Message ollamaMessage `json:"message"`
-	Done    bool          `json:"done"`
-	Error   string        `json:"error,omitempty"`
+	Message         chatMessage `json:"message"`
+	Done            bool        `json:"done"`
+	PromptEvalCount int         `json:"prompt_eval_count,omitempty"`
+	EvalCount       int         `json:"eval_count,omitempty"`
+	Error           string      `json:"error,omitempty"`
 }
 
 type summaryPayload struct {
-	SummaryMarkdown string   `json:"summary_md"`
-	Highlights      []string `json:"highlights,omitempty"`
-	ActionItems     []string `json:"action_items,omitempty"`
-	Confidence      float64  `json:"confidence,omitempty"`
+	SummaryMarkdown string            `json:"summary_md"`
+	Highlights      []string          `json:"highlights,omitempty"`
+	ActionItems     []string          `json:"action_items,omitempty"`
+	Confidence      float64           `json:"confidence,omitempty"`
+	Citations       []citationPayload `json:"citations,omitempty"`
 }
 
-func SummarizeOllama(ctx context.Context, settings Settings, input Input) (types.Summary, error) {
-	model := strings.TrimSpace(settings.OllamaModel)
+type citationPayload struct {
+	Evidence int    `json:"evidence"`
+	Quote    string `json:"quote"`
+}
+
+func init() {
+	Register("ollama", newOllamaProvider)
+}
+
+type ollamaProvider struct {
+	settings OllamaSettings
+	model    string
+	baseURL  string
+	budget   Budget
+}
+
+func newOllamaProvider(settings Settings) (Provider, error) {
+	model := strings.TrimSpace(settings.Ollama.Model)
 	if model == "" {
-		return types.Summary{}, errors.New("OLLAMA_MODEL is required")
+		return nil, errors.New("OLLAMA_MODEL is required")
 	}
-	baseURL := strings.TrimRight(strings.TrimSpace(settings.OllamaURL), "/")
+	baseURL := strings.TrimRight(strings.TrimSpace(settings.Ollama.URL), "/")
 	if baseURL == "" {
-		return types.Summary{}, errors.New("OLLAMA_URL is required")
+		return nil, errors.New("OLLAMA_URL is required")
+	}
+	return &ollamaProvider{
+		settings: settings.Ollama,
+		model:    model,
+		baseURL:  baseURL,
+		budget:   newBudget(settings, model),
+	}, nil
+}
+
+func (p *ollamaProvider) Name() string {
+	return "ollama"
+}
+
+func (p *ollamaProvider) Summarize(ctx context.Context, input Input) (types.Summary, error) {
+	system, user := renderPrompts(input, p.budget)
+	messages := []chatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: user},
 	}
+	return completeSummary(ctx, p.chat, input, "ollama:"+p.model, messages)
+}
+
+func (p *ollamaProvider) chat(ctx context.Context, messages []chatMessage) (content string, err error) {
+	ctx, span := startChat(ctx, "ollama:"+p.model)
+	start := time.Now()
+	var response ollamaResponse
+	defer func() {
+		observeChat(span, "ollama:"+p.model, start, err, response.PromptEvalCount, response.EvalCount)
+	}()
 	reqPayload := ollamaRequest{
-		Model:  model,
-		Stream: false,
-		Format: "json",
-		Messages: []ollamaMessage{
-			{Role: "system", Content: ollamaSystemPrompt()},
-			{Role: "user", Content: buildUserPrompt(input, settings.MaxInputBytes)},
-		},
-	}
-	if settings.OllamaTemp > 0 {
+		Model:    p.model,
+		Stream:   false,
+		Format:   "json",
+		Messages: messages,
+	}
+	if p.settings.Temperature > 0 {
 		reqPayload.Options = map[string]any{
-			"temperature": settings.OllamaTemp,
+			"temperature": p.settings.Temperature,
 		}
 	}
 	payload, err := json.Marshal(reqPayload)
 	if err != nil {
-		return types.Summary{}, fmt.Errorf("marshal request: %w", err)
+		return "", fmt.Errorf("marshal request: %w", err)
 	}
 
 	httpClient := &http.Client{Timeout: 120 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/chat", bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/chat", bytes.NewReader(payload))
 	if err != nil {
-		return types.Summary{}, fmt.Errorf("build request: %w", err)
+		return "", fmt.Errorf("build request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return types.Summary{}, fmt.Errorf("ollama request: %w", err)
+		return "", fmt.Errorf("ollama request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	var response ollamaResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return types.Summary{}, fmt.Errorf("decode response: %w", err)
+		return "", fmt.Errorf("decode response: %w", err)
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		if response.Error != "" {
-			return types.Summary{}, fmt.Errorf("ollama error: %s", response.Error)
+			return "", failure.HTTP(resp.StatusCode, fmt.Errorf("ollama error: %s", response.Error))
 		}
-		return types.Summary{}, fmt.Errorf("ollama http %d", resp.StatusCode)
+		return "", failure.HTTP(resp.StatusCode, fmt.Errorf("ollama http %d", resp.StatusCode))
 	}
 	if response.Error != "" {
-		return types.Summary{}, fmt.Errorf("ollama error: %s", response.Error)
+		return "", fmt.Errorf("ollama error: %s", response.Error)
 	}
-	content := strings.TrimSpace(response.Message.Content)
+	content = strings.TrimSpace(response.Message.Content)
 	if content == "" {
-		return types.Summary{}, errors.New("ollama response empty")
+		return "", errors.New("ollama response empty")
 	}
+	return content, nil
+}
+
+func summaryFromContent(input Input, model, content string) types.Summary {
 	summary := types.Summary{
 		IncidentID: input.Bundle.IncidentID,
-		Model:      "ollama:" + model,
+		Model:      model,
 	}
 	if payload, ok := parseSummaryJSON(content); ok {
 		summary.SummaryMarkdown = payload.SummaryMarkdown
 		summary.Highlights = payload.Highlights
 		summary.ActionItems = payload.ActionItems
 		summary.Confidence = payload.Confidence
+		summary.Citations = citationsFromPayload(payload.Citations, input.Evidence)
 	}
 	if summary.SummaryMarkdown == "" {
 		summary.SummaryMarkdown = content
 	}
-	return summary, nil
+	return summary
 }
 
-func ollamaSystemPrompt() string {
+func systemPrompt() string {
 	return strings.Join([]string{
 		"You are an incident analysis assistant.",
 		"Use only the provided evidence for factual claims. If unsure, say \"unknown\".",
@@ -128,23 +177,30 @@ func ollamaSystemPrompt() string {
 		"- Hypotheses: possible causes, clearly labeled as hypotheses.",
 		"- Next steps: concrete checks or fixes.",
 		"highlights and action_items must be arrays of short strings (no objects).",
+		"Optional key: citations (array of objects with evidence (the [n] number of the evidence item) and quote (an exact substring copied from that item)).",
+		"Every quote in the Evidence section should also appear in citations.",
 	}, "\n")
 }
 
-func buildUserPrompt(input Input, maxBytes int) string {
-	var b strings.Builder
-	b.WriteString("Incident metadata:\n")
+func buildUserPrompt(system string, input Input, budget Budget) string {
+	var meta strings.Builder
+	meta.WriteString("Incident metadata:\n")
 	if input.Bundle.IncidentID != "" {
-		b.WriteString("- id: " + input.Bundle.IncidentID + "\n")
+		meta.WriteString("- id: " + input.Bundle.IncidentID + "\n")
 	}
 	if input.Bundle.CollectedAt != "" {
-		b.WriteString("- collected_at: " + input.Bundle.CollectedAt + "\n")
+		meta.WriteString("- collected_at: " + input.Bundle.CollectedAt + "\n")
 	}
 	if len(input.Bundle.NormalizedContext) > 0 {
 		if data, err := json.Marshal(input.Bundle.NormalizedContext); err == nil {
-			b.WriteString("- context: " + string(data) + "\n")
+			meta.WriteString("- context: " + string(data) + "\n")
 		}
 	}
+	metadata := meta.String()
+	input = budget.Fit(system, metadata, input)
+
+	var b strings.Builder
+	b.WriteString(metadata)
 	if len(input.Evidence) == 0 {
 		b.WriteString("\nEvidence: none\n")
 	} else {
@@ -156,7 +212,7 @@ func buildUserPrompt(input Input, maxBytes int) string {
 		}
 	}
 	raw := b.String()
-	return truncateToBytes(raw, maxBytes)
+	return truncateToBytes(raw, budget.MaxBytes)
 }
 
 func truncateToBytes(value string, maxBytes int) string {
@@ -171,6 +227,21 @@ func truncateToBytes(value string, maxBytes int) string {
 }
 
 func parseSummaryJSON(raw string) (summaryPayload, bool) {
+	candidate, ok := extractJSONObject(raw)
+	if !ok {
+		return summaryPayload{}, false
+	}
+	var payload summaryPayload
+	if err := json.Unmarshal([]byte(candidate), &payload); err != nil {
+		return summaryPayload{}, false
+	}
+	normalizeSummaryPayload(&payload)
+	return payload, true
+}
+
+// extractJSONObject strips code fences and surrounding prose from a model
+// reply and returns the first candidate that decodes as a JSON object.
+func extractJSONObject(raw string) (string, bool) {
 	trimmed := strings.TrimSpace(raw)
 	if strings.HasPrefix(trimmed, "```") {
 		trimmed = strings.TrimPrefix(trimmed, "```")
@@ -182,20 +253,19 @@ func parseSummaryJSON(raw string) (summaryPayload, bool) {
 		}
 		trimmed = strings.TrimSpace(trimmed)
 	}
-	var payload summaryPayload
-	if err := json.Unmarshal([]byte(trimmed), &payload); err == nil {
-		normalizeSummaryPayload(&payload)
-		return payload, true
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(trimmed), &obj); err == nil {
+		return trimmed, true
 	}
 	start := strings.Index(trimmed, "{")
 	end := strings.LastIndex(trimmed, "}")
 	if start >= 0 && end > start {
-		if err := json.Unmarshal([]byte(trimmed[start:end+1]), &payload); err == nil {
-			normalizeSummaryPayload(&payload)
-			return payload, true
+		candidate := trimmed[start : end+1]
+		if err := json.Unmarshal([]byte(candidate), &obj); err == nil {
+			return candidate, true
 		}
 	}
-	return summaryPayload{}, false
+	return "", false
 }
 
 func normalizeSummaryPayload(payload *summaryPayload) {
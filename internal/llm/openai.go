@@ -1,12 +1,161 @@
 package llm
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
 )
 
-func SummarizeOpenAI(_ context.Context, _ Settings, _ Input) (types.Summary, error) {
-	return types.Summary{}, errors.New("openai summarizer not configured")
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type openAIRequest struct {
+	Model          string                `json:"model"`
+	Messages       []chatMessage         `json:"messages"`
+	Temperature    *float64              `json:"temperature,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIChoice struct {
+	Message      chatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+type openAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIResponse struct {
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+	Error   *openAIError   `json:"error,omitempty"`
+}
+
+func init() {
+	Register("openai", newOpenAIProvider)
+}
+
+type openAIProvider struct {
+	settings OpenAISettings
+	model    string
+	baseURL  string
+	apiKey   string
+	budget   Budget
+}
+
+func newOpenAIProvider(settings Settings) (Provider, error) {
+	model := strings.TrimSpace(settings.OpenAI.Model)
+	if model == "" {
+		return nil, errors.New("OPENAI_MODEL is required")
+	}
+	baseURL := strings.TrimRight(strings.TrimSpace(settings.OpenAI.BaseURL), "/")
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	apiKey := strings.TrimSpace(settings.OpenAI.APIKey)
+	if apiKey == "" && baseURL == defaultOpenAIBaseURL {
+		return nil, errors.New("OPENAI_API_KEY is required")
+	}
+	return &openAIProvider{
+		settings: settings.OpenAI,
+		model:    model,
+		baseURL:  baseURL,
+		apiKey:   apiKey,
+		budget:   newBudget(settings, model),
+	}, nil
+}
+
+func (p *openAIProvider) Name() string {
+	return "openai"
+}
+
+func (p *openAIProvider) Summarize(ctx context.Context, input Input) (types.Summary, error) {
+	system, user := renderPrompts(input, p.budget)
+	messages := []chatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: user},
+	}
+	return completeSummary(ctx, p.chat, input, "openai:"+p.model, messages)
+}
+
+func (p *openAIProvider) chat(ctx context.Context, messages []chatMessage) (content string, err error) {
+	ctx, span := startChat(ctx, "openai:"+p.model)
+	start := time.Now()
+	var usage openAIUsage
+	defer func() {
+		observeChat(span, "openai:"+p.model, start, err, usage.PromptTokens, usage.CompletionTokens)
+	}()
+	reqPayload := openAIRequest{
+		Model:          p.model,
+		Messages:       messages,
+		ResponseFormat: &openAIResponseFormat{Type: "json_object"},
+	}
+	if p.settings.Temperature > 0 {
+		temp := p.settings.Temperature
+		reqPayload.Temperature = &temp
+	}
+	payload, err := json.Marshal(reqPayload)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpClient := &http.Client{Timeout: 120 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("openai request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response openAIResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if decodeErr == nil && response.Error != nil && response.Error.Message != "" {
+			return "", failure.HTTP(resp.StatusCode, fmt.Errorf("openai error: %s", response.Error.Message))
+		}
+		return "", failure.HTTP(resp.StatusCode, fmt.Errorf("openai http %d", resp.StatusCode))
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("decode response: %w", decodeErr)
+	}
+	if response.Usage != nil {
+		usage = *response.Usage
+	}
+	if response.Error != nil && response.Error.Message != "" {
+		return "", fmt.Errorf("openai error: %s", response.Error.Message)
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("openai response has no choices")
+	}
+	content = strings.TrimSpace(response.Choices[0].Message.Content)
+	if content == "" {
+		return "", errors.New("openai response empty")
+	}
+	return content, nil
 }
@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// openAIServer serves /chat/completions with status and body, recording the
+// last request it received.
+func openAIServer(t *testing.T, status int, body string, got *openAIRequest) *openAIProvider {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s, want /chat/completions", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if got != nil {
+			data, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(data, got); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	provider, err := newOpenAIProvider(Settings{OpenAI: OpenAISettings{
+		APIKey:  "test-key",
+		Model:   "gpt-test",
+		BaseURL: srv.URL + "/",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider.(*openAIProvider)
+}
+
+// completion wraps content in a chat completions response.
+func completion(content string) string {
+	data, _ := json.Marshal(openAIResponse{
+		Model:   "gpt-test",
+		Choices: []openAIChoice{{Message: chatMessage{Role: "assistant", Content: content}, FinishReason: "stop"}},
+		Usage:   &openAIUsage{PromptTokens: 10, CompletionTokens: 5},
+	})
+	return string(data)
+}
+
+func TestOpenAISummarize(t *testing.T) {
+	var req openAIRequest
+	provider := openAIServer(t, http.StatusOK,
+		completion(`{"summary_md":"Disk full on db-1.","highlights":["disk full"],"action_items":["free space"],"confidence":0.8}`), &req)
+
+	input := Input{Bundle: types.EvidenceBundle{IncidentID: "inc-1"}}
+	summary, err := provider.Summarize(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.SummaryMarkdown != "Disk full on db-1." || summary.Confidence != 0.8 || summary.Model != "openai:gpt-test" {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(summary.Highlights) != 1 || len(summary.ActionItems) != 1 {
+		t.Errorf("highlights = %v, action_items = %v", summary.Highlights, summary.ActionItems)
+	}
+	if req.Model != "gpt-test" || req.ResponseFormat == nil || req.ResponseFormat.Type != "json_object" {
+		t.Errorf("request = %+v", req)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Role != "user" {
+		t.Errorf("messages = %+v", req.Messages)
+	}
+	if req.Temperature != nil {
+		t.Errorf("temperature sent without being configured: %v", *req.Temperature)
+	}
+}
+
+func TestOpenAIChatErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+		kind    failure.Kind
+	}{
+		{
+			name:    "server error",
+			status:  http.StatusServiceUnavailable,
+			body:    `{"error":{"message":"overloaded","type":"server_error"}}`,
+			wantErr: "openai error: overloaded",
+			kind:    failure.UpstreamTransient,
+		},
+		{
+			name:    "rate limited without body",
+			status:  http.StatusTooManyRequests,
+			body:    ``,
+			wantErr: "openai http 429",
+			kind:    failure.UpstreamTransient,
+		},
+		{
+			name:    "bad key",
+			status:  http.StatusUnauthorized,
+			body:    `{"error":{"message":"invalid api key","type":"invalid_request_error"}}`,
+			wantErr: "openai error: invalid api key",
+			kind:    failure.UpstreamPermanent,
+		},
+		{
+			name:    "no choices",
+			status:  http.StatusOK,
+			body:    `{"model":"gpt-test","choices":[]}`,
+			wantErr: "openai response has no choices",
+			kind:    failure.UpstreamTransient,
+		},
+		{
+			name:    "choices not an array",
+			status:  http.StatusOK,
+			body:    `{"model":"gpt-test","choices":{"message":"hi"}}`,
+			wantErr: "decode response",
+			kind:    failure.UpstreamTransient,
+		},
+		{
+			name:    "empty content",
+			status:  http.StatusOK,
+			body:    completion("  "),
+			wantErr: "openai response empty",
+			kind:    failure.UpstreamTransient,
+		},
+		{
+			name:    "error in a 200",
+			status:  http.StatusOK,
+			body:    `{"error":{"message":"model overloaded"}}`,
+			wantErr: "openai error: model overloaded",
+			kind:    failure.UpstreamTransient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := openAIServer(t, tt.status, tt.body, nil)
+			_, err := provider.chat(context.Background(), []chatMessage{{Role: "user", Content: "hi"}})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+			if kind := failure.Classify(err); kind != tt.kind {
+				t.Errorf("kind = %s, want %s", kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestNewOpenAIProviderRequiresKeyForDefaultURL(t *testing.T) {
+	if _, err := newOpenAIProvider(Settings{OpenAI: OpenAISettings{Model: "gpt-test"}}); err == nil {
+		t.Error("expected an error without OPENAI_API_KEY for the default base URL")
+	}
+	if _, err := newOpenAIProvider(Settings{OpenAI: OpenAISettings{Model: "gpt-test", BaseURL: "http://localhost:8000/v1"}}); err != nil {
+		t.Errorf("compatible server without a key: %v", err)
+	}
+}
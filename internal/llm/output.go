@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/metrics"
+	"github.com/coretexos/coretex-incident-enricher/internal/schema"
+	"github.com/coretexos/coretex-incident-enricher/internal/tracing"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+	"github.com/coretexos/coretex-incident-enricher/pack"
+)
+
+// modelReplyKeys are the Summary fields the model is asked to produce; the
+// rest of the schema (incident_id, model, artifact_ptr, ...) is filled in by
+// the summarizer and citations use a prompt-specific shape.
+var modelReplyKeys = []string{"summary_md", "highlights", "action_items", "confidence"}
+
+var (
+	// parseFailures counts model replies that failed schema validation;
+	// rawFallbacks counts replies that were still invalid after the repair
+	// request and were used as raw text.
+	parseFailures   = metrics.NewCounter("llm_parse_failures_total", "LLM replies that failed schema validation, by model.", "model")
+	rawFallbacks    = metrics.NewCounter("llm_raw_fallbacks_total", "LLM replies used as raw text after a failed repair, by model.", "model")
+	requestDuration = metrics.NewHistogram("llm_request_duration_seconds", "LLM chat request latency, by model and outcome.", nil, "model", "outcome")
+	tokensUsed      = metrics.NewCounter("llm_tokens_total", "Tokens reported by LLM providers, by model and kind (prompt or completion).", "model", "kind")
+
+	summarySchemaOnce sync.Once
+	summarySchema     *schema.Schema
+	summarySchemaErr  error
+)
+
+type chatFunc func(ctx context.Context, messages []chatMessage) (string, error)
+
+// startChat starts the client span for one chat request.
+func startChat(ctx context.Context, model string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "llm.chat", trace.SpanKindClient, attribute.String("llm.model", model))
+}
+
+// observeChat records one chat request's latency and, when the provider
+// reports them, its token counts, and ends its span.
+func observeChat(span trace.Span, model string, start time.Time, err error, promptTokens, completionTokens int) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	requestDuration.Observe(time.Since(start).Seconds(), model, outcome)
+	tokensUsed.Add(float64(promptTokens), model, "prompt")
+	tokensUsed.Add(float64(completionTokens), model, "completion")
+	span.SetAttributes(
+		attribute.Int("llm.usage.prompt_tokens", promptTokens),
+		attribute.Int("llm.usage.completion_tokens", completionTokens),
+	)
+	tracing.End(span, err)
+}
+
+// completeSummary sends messages, validates the reply against the pack's
+// Summary schema and, if it does not conform, asks the same model once to
+// repair it before falling back to the lenient parse of the original reply.
+func completeSummary(ctx context.Context, chat chatFunc, input Input, model string, messages []chatMessage) (types.Summary, error) {
+	content, err := chat(ctx, messages)
+	if err != nil {
+		return types.Summary{}, err
+	}
+	violations := validateReply(input, content)
+	if len(violations) == 0 {
+		return summaryFromContent(input, model, content), nil
+	}
+	parseFailures.Inc(model)
+
+	repair := append(append([]chatMessage{}, messages...),
+		chatMessage{Role: "assistant", Content: content},
+		chatMessage{Role: "user", Content: repairPrompt(violations)},
+	)
+	repaired, err := chat(ctx, repair)
+	if err == nil {
+		if len(validateReply(input, repaired)) == 0 {
+			return summaryFromContent(input, model, repaired), nil
+		}
+		parseFailures.Inc(model)
+		if _, ok := parseSummaryJSON(repaired); ok {
+			content = repaired
+		}
+	} else if ctx.Err() != nil {
+		return types.Summary{}, err
+	}
+	if _, ok := parseSummaryJSON(content); !ok {
+		rawFallbacks.Inc(model)
+	}
+	return summaryFromContent(input, model, content), nil
+}
+
+func validateReply(input Input, content string) []schema.Violation {
+	compiled, err := loadSummarySchema()
+	if err != nil {
+		return nil
+	}
+	candidate, ok := extractJSONObject(content)
+	if !ok {
+		return []schema.Violation{{Message: "reply is not a JSON object"}}
+	}
+	var reply map[string]any
+	if err := json.Unmarshal([]byte(candidate), &reply); err != nil {
+		return []schema.Violation{{Message: "reply is not a JSON object"}}
+	}
+	doc := map[string]any{"incident_id": input.Bundle.IncidentID}
+	if input.Bundle.IncidentID == "" {
+		doc["incident_id"] = "unknown"
+	}
+	for _, key := range modelReplyKeys {
+		if val, ok := reply[key]; ok {
+			doc[key] = val
+		}
+	}
+	return compiled.Validate(doc)
+}
+
+func repairPrompt(violations []schema.Violation) string {
+	var b strings.Builder
+	b.WriteString("Your previous reply did not match the required JSON schema:\n")
+	for _, v := range violations {
+		b.WriteString("- " + v.String() + "\n")
+	}
+	b.WriteString(fmt.Sprintf("Reply again with a single JSON object containing %s, fixing these problems. Do not add any other text.", strings.Join(modelReplyKeys, ", ")))
+	return b.String()
+}
+
+func loadSummarySchema() (*schema.Schema, error) {
+	summarySchemaOnce.Do(func() {
+		data, err := pack.Schema("Summary")
+		if err != nil {
+			summarySchemaErr = err
+			return
+		}
+		summarySchema, summarySchemaErr = schema.Compile(data)
+	})
+	return summarySchema, summarySchemaErr
+}
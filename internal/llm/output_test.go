@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// scriptedChat replies with replies in turn and records the messages of
+// every call; a reply of "ERR" fails the call.
+type scriptedChat struct {
+	replies []string
+	calls   [][]chatMessage
+}
+
+func (c *scriptedChat) chat(_ context.Context, messages []chatMessage) (string, error) {
+	c.calls = append(c.calls, messages)
+	reply := c.replies[len(c.calls)-1]
+	if reply == "ERR" {
+		return "", errors.New("connection reset")
+	}
+	return reply, nil
+}
+
+func TestCompleteSummaryRepair(t *testing.T) {
+	valid := `{"summary_md":"fixed","highlights":["a"],"action_items":[],"confidence":0.5}`
+	tests := []struct {
+		name    string
+		replies []string
+		want    string
+		calls   int
+		// repairHint must appear in the repair request.
+		repairHint string
+	}{
+		{
+			name:    "valid reply",
+			replies: []string{valid},
+			want:    "fixed",
+			calls:   1,
+		},
+		{
+			name:       "repaired",
+			replies:    []string{`{"summary_md":"first","highlights":[{"text":"a"}]}`, valid},
+			want:       "fixed",
+			calls:      2,
+			repairHint: "highlights[0]: expected string, got object",
+		},
+		{
+			name:       "repair still invalid but parses",
+			replies:    []string{`not json`, `{"summary_md":"second","confidence":1.5}`},
+			want:       "second",
+			calls:      2,
+			repairHint: "reply is not a JSON object",
+		},
+		{
+			name:       "raw fallback",
+			replies:    []string{`The disk is full.`, `Still prose.`},
+			want:       "The disk is full.",
+			calls:      2,
+			repairHint: "reply is not a JSON object",
+		},
+		{
+			name:       "repair request fails",
+			replies:    []string{`{"summary_md":"first","confidence":2}`, "ERR"},
+			want:       "first",
+			calls:      2,
+			repairHint: "confidence: must be <= 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := &scriptedChat{replies: tt.replies}
+			input := Input{Bundle: types.EvidenceBundle{IncidentID: "inc-1"}}
+			messages := []chatMessage{{Role: "system", Content: "sys"}, {Role: "user", Content: "evidence"}}
+			summary, err := completeSummary(context.Background(), chat.chat, input, "test:model", messages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.SummaryMarkdown != tt.want || summary.IncidentID != "inc-1" || summary.Model != "test:model" {
+				t.Errorf("summary = %+v, want summary_md %q", summary, tt.want)
+			}
+			if len(chat.calls) != tt.calls {
+				t.Fatalf("got %d calls, want %d", len(chat.calls), tt.calls)
+			}
+			if tt.calls < 2 {
+				return
+			}
+			repair := chat.calls[1]
+			if len(repair) != 4 || repair[2].Role != "assistant" || repair[2].Content != tt.replies[0] || repair[3].Role != "user" {
+				t.Fatalf("repair request = %+v, want the conversation plus the first reply and a correction", repair)
+			}
+			if !strings.Contains(repair[3].Content, tt.repairHint) {
+				t.Errorf("repair prompt %q does not mention %q", repair[3].Content, tt.repairHint)
+			}
+		})
+	}
+}
+
+func TestCompleteSummaryCancelledRepair(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	chat := func(_ context.Context, messages []chatMessage) (string, error) {
+		if len(messages) > 2 {
+			cancel()
+			return "", context.Canceled
+		}
+		return "prose", nil
+	}
+	if _, err := completeSummary(ctx, chat, Input{}, "test:model", []chatMessage{{}, {}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the cancellation instead of a raw fallback", err)
+	}
+}
@@ -0,0 +1,201 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+const (
+	builtinTemplateName = "builtin"
+	systemTemplateExt   = ".system.tmpl"
+	userTemplateExt     = ".user.tmpl"
+)
+
+// Template is a named pair of system/user prompt templates. Either half may be
+// nil, in which case the built-in prompt is used for that message.
+type Template struct {
+	Name    string
+	Version string
+	System  *template.Template
+	User    *template.Template
+}
+
+// PromptData is what prompt templates are executed with.
+type PromptData struct {
+	IncidentID        string
+	Bundle            types.EvidenceBundle
+	NormalizedContext map[string]any
+	Evidence          []EvidenceText
+}
+
+// TemplateSet holds the templates found in a prompts directory, named by
+// file: <name>.system.tmpl and <name>.user.tmpl.
+type TemplateSet struct {
+	templates map[string]*Template
+}
+
+var promptFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"add":   func(a, b int) int { return a + b },
+}
+
+func LoadTemplates(fsys fs.FS) (*TemplateSet, error) {
+	set := &TemplateSet{templates: map[string]*Template{}}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read prompts: %w", err)
+	}
+	sources := map[string][]byte{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := entry.Name()
+		var name, ext string
+		switch {
+		case strings.HasSuffix(file, systemTemplateExt):
+			ext = systemTemplateExt
+		case strings.HasSuffix(file, userTemplateExt):
+			ext = userTemplateExt
+		default:
+			continue
+		}
+		name = strings.ToLower(strings.TrimSuffix(file, ext))
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("read prompt %s: %w", file, err)
+		}
+		parsed, err := template.New(file).Funcs(promptFuncs).Option("missingkey=zero").Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse prompt %s: %w", file, err)
+		}
+		tmpl, ok := set.templates[name]
+		if !ok {
+			tmpl = &Template{Name: name}
+			set.templates[name] = tmpl
+		}
+		if ext == userTemplateExt {
+			tmpl.User = parsed
+		} else {
+			tmpl.System = parsed
+		}
+		sources[name+ext] = data
+	}
+	for name, tmpl := range set.templates {
+		h := sha256.New()
+		for _, ext := range []string{systemTemplateExt, userTemplateExt} {
+			h.Write(sources[name+ext])
+			h.Write([]byte{0})
+		}
+		tmpl.Version = hex.EncodeToString(h.Sum(nil))[:12]
+	}
+	return set, nil
+}
+
+// Select picks a template: the explicitly requested name, then
+// severity-<severity>, then source-<system>, then default. It returns nil when
+// none exist so callers fall back to the built-in prompt.
+func (s *TemplateSet) Select(requested, severity, source string) *Template {
+	if s == nil {
+		return nil
+	}
+	candidates := []string{requested}
+	if severity != "" {
+		candidates = append(candidates, "severity-"+severity)
+	}
+	if source != "" {
+		candidates = append(candidates, "source-"+source)
+	}
+	candidates = append(candidates, "default")
+	for _, name := range candidates {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if tmpl, ok := s.templates[name]; ok {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+// TemplateVersion identifies the prompt an input will be rendered with. The
+// built-in system prompt is identified by a hash of its text, so editing it
+// changes the version of every input that uses it.
+func (in Input) TemplateVersion() string {
+	builtin := builtinTemplateName + "@" + builtinVersion()
+	if in.Template == nil {
+		return builtin
+	}
+	version := in.Template.Name + "@" + in.Template.Version
+	if in.Template.System == nil {
+		version += "+" + builtin
+	}
+	return version
+}
+
+var builtinVersion = sync.OnceValue(func() string {
+	sum := sha256.Sum256([]byte(systemPrompt()))
+	return hex.EncodeToString(sum[:])[:12]
+})
+
+// renderPrompts returns the system and user messages for input, trimming
+// evidence to fit budget. Template errors fall back to the built-in prompt.
+func renderPrompts(input Input, budget Budget) (string, string) {
+	system := systemPrompt()
+	if input.Template != nil && input.Template.System != nil {
+		if out, err := executePrompt(input.Template.System, input); err == nil && strings.TrimSpace(out) != "" {
+			system = strings.TrimRight(out, "\n")
+		}
+	}
+	if input.Template == nil || input.Template.User == nil {
+		return system, buildUserPrompt(system, input, budget)
+	}
+	// Render once without evidence content to charge the template's own
+	// text against the budget, then render with the fitted evidence.
+	skeleton := input
+	skeleton.Evidence = make([]EvidenceText, len(input.Evidence))
+	for i, item := range input.Evidence {
+		item.Content = ""
+		skeleton.Evidence[i] = item
+	}
+	frame, err := executePrompt(input.Template.User, skeleton)
+	if err != nil {
+		return system, buildUserPrompt(system, input, budget)
+	}
+	fitted := budget.Fit(system, frame, input)
+	user, err := executePrompt(input.Template.User, fitted)
+	if err != nil {
+		return system, buildUserPrompt(system, input, budget)
+	}
+	return system, truncateToBytes(user, budget.MaxBytes)
+}
+
+func executePrompt(tmpl *template.Template, input Input) (string, error) {
+	data := PromptData{
+		IncidentID:        input.Bundle.IncidentID,
+		Bundle:            input.Bundle,
+		NormalizedContext: input.Bundle.NormalizedContext,
+		Evidence:          input.Evidence,
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
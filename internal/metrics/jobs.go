@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
+	"github.com/coretexos/cap/v2/sdk/go/worker"
+)
+
+var (
+	jobsTotal   = NewCounter("jobs_total", "Jobs handled by workers, by service and final status.", "service", "status")
+	jobDuration = NewHistogram("job_duration_seconds", "Job execution time, by service and final status.", nil, "service", "status")
+	jobsActive  = NewGauge("jobs_active", "Jobs currently executing, by service.", "service")
+)
+
+// InstrumentJobs wraps a worker handler to count jobs by status and record
+// their execution time. A handler error counts as failed, matching how the
+// worker SDK reports it.
+func InstrumentJobs(service string, next worker.Handler) worker.Handler {
+	return func(ctx context.Context, req *agentv1.JobRequest) (*agentv1.JobResult, error) {
+		start := time.Now()
+		jobsActive.Add(1, service)
+		defer jobsActive.Add(-1, service)
+		res, err := next(ctx, req)
+		status := "failed"
+		if err == nil && res != nil {
+			status = jobStatus(res.GetStatus())
+		}
+		jobsTotal.Inc(service, status)
+		jobDuration.Observe(time.Since(start).Seconds(), service, status)
+		return res, err
+	}
+}
+
+func jobStatus(status agentv1.JobStatus) string {
+	name := strings.TrimPrefix(status.String(), "JOB_STATUS_")
+	return strings.ToLower(name)
+}
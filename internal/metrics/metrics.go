@@ -0,0 +1,278 @@
+// Package metrics is a small Prometheus text-format registry shared by the
+// ingester and the workers. Metrics are declared as package variables next
+// to the code that updates them and served at /metrics on METRICS_ADDR.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Namespace prefixes every metric name.
+const Namespace = "incident_enricher_"
+
+// DefaultBuckets suit request and job latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var registry = struct {
+	mu      sync.Mutex
+	metrics map[string]collector
+}{metrics: map[string]collector{}}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+func register(name string, c collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, dup := registry.metrics[name]; dup {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry.metrics[name] = c
+}
+
+// family holds the label names and per-series state shared by every kind.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{name: Namespace + name, help: help, kind: kind, labels: labels, series: map[string]*series{}}
+}
+
+// get returns the series for values, creating it on first use. Missing
+// label values are recorded as "".
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		fixed := make([]string, len(f.labels))
+		copy(fixed, values)
+		values = fixed
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) sorted() []*series {
+	out := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].values, "\xff") < strings.Join(out[j].values, "\xff")
+	})
+	return out
+}
+
+func (f *family) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+}
+
+func (f *family) labelString(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range f.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a monotonically increasing value per label set.
+type Counter struct{ f *family }
+
+// NewCounter registers a counter; labels name the values passed to Inc and Add.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{f: newFamily(name, help, "counter", labels)}
+	register(c.f.name, c)
+	return c
+}
+
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	c.f.mu.Lock()
+	c.f.get(values).value += delta
+	c.f.mu.Unlock()
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.header(w)
+	for _, s := range c.f.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.f.name, c.f.labelString(s.values), formatFloat(s.value))
+	}
+}
+
+// Gauge is a value that goes up and down per label set.
+type Gauge struct{ f *family }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{f: newFamily(name, help, "gauge", labels)}
+	register(g.f.name, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.get(values).value = v
+	g.f.mu.Unlock()
+}
+
+func (g *Gauge) Add(delta float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.get(values).value += delta
+	g.f.mu.Unlock()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	g.f.header(w)
+	for _, s := range g.f.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", g.f.name, g.f.labelString(s.values), formatFloat(s.value))
+	}
+}
+
+// Histogram counts observations into cumulative buckets per label set.
+type Histogram struct {
+	f       *family
+	buckets []float64
+}
+
+// NewHistogram registers a histogram; nil buckets means DefaultBuckets.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{f: newFamily(name, help, "histogram", labels), buckets: buckets}
+	register(h.f.name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.get(values)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	h.f.header(w)
+	for _, s := range h.f.sorted() {
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.f.name, h.f.labelString(s.values, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.f.name, h.f.labelString(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.f.name, h.f.labelString(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.f.name, h.f.labelString(s.values), s.count)
+	}
+}
+
+// WriteText writes every registered metric in the Prometheus text format.
+func WriteText(w io.Writer) {
+	registry.mu.Lock()
+	names := make([]string, 0, len(registry.metrics))
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, registry.metrics[name])
+	}
+	registry.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteText(w)
+	})
+}
+
+// Serve exposes /metrics on addr in the background; an empty addr disables
+// it. service only labels the log line.
+func Serve(addr, service string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("%s: metrics listener: %v", service, err)
+		}
+	}()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v)
+}
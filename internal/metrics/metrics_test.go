@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	testCounter   = NewCounter("test_requests_total", "Requests.\nSecond line with a back\\slash.", "zone", "app")
+	testGauge     = NewGauge("test_queue_depth", "Queue depth.")
+	testHistogram = NewHistogram("test_latency_seconds", "Latency.", []float64{1, 0.5}, "app")
+)
+
+const golden = `# HELP incident_enricher_test_requests_total Requests.\nSecond line with a back\\slash.
+# TYPE incident_enricher_test_requests_total counter
+incident_enricher_test_requests_total{zone="a",app="ok"} 2.5
+incident_enricher_test_requests_total{zone="a",app="x\"y\\z\nw"} 1
+incident_enricher_test_requests_total{zone="b",app="ok"} 2
+incident_enricher_test_requests_total{zone="",app=""} 1
+# HELP incident_enricher_test_queue_depth Queue depth.
+# TYPE incident_enricher_test_queue_depth gauge
+incident_enricher_test_queue_depth 1.5
+# HELP incident_enricher_test_latency_seconds Latency.
+# TYPE incident_enricher_test_latency_seconds histogram
+incident_enricher_test_latency_seconds_bucket{app="api",le="0.5"} 1
+incident_enricher_test_latency_seconds_bucket{app="api",le="1"} 2
+incident_enricher_test_latency_seconds_bucket{app="api",le="+Inf"} 3
+incident_enricher_test_latency_seconds_sum{app="api"} 4
+incident_enricher_test_latency_seconds_count{app="api"} 3
+`
+
+func TestExposition(t *testing.T) {
+	testCounter.Inc("b", "ok")
+	testCounter.Inc("b", "ok")
+	testCounter.Inc("a", "x\"y\\z\nw")
+	testCounter.Add(2.5, "a", "ok")
+	testCounter.Add(-1, "a", "ok")
+	testCounter.Inc()
+	testGauge.Set(3)
+	testGauge.Add(-1.5)
+	testHistogram.Observe(0.25, "api")
+	testHistogram.Observe(0.75, "api")
+	testHistogram.Observe(3, "api")
+
+	var b strings.Builder
+	testCounter.write(&b)
+	testGauge.write(&b)
+	testHistogram.write(&b)
+	if b.String() != golden {
+		t.Errorf("exposition:\n%s\nwant:\n%s", b.String(), golden)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	// The registry writes families sorted by name, each whole.
+	body := rec.Body.String()
+	latency := strings.Index(body, "# HELP incident_enricher_test_latency_seconds")
+	depth := strings.Index(body, "# HELP incident_enricher_test_queue_depth")
+	requests := strings.Index(body, "# HELP incident_enricher_test_requests_total")
+	if latency < 0 || !(latency < depth && depth < requests) {
+		t.Errorf("families out of order: latency at %d, depth at %d, requests at %d", latency, depth, requests)
+	}
+	if !strings.Contains(body, golden[strings.Index(golden, "# HELP incident_enricher_test_latency"):]) {
+		t.Error("served histogram differs from its own exposition")
+	}
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a metric twice did not panic")
+		}
+	}()
+	NewGauge("test_queue_depth", "Again.")
+}
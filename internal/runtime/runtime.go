@@ -0,0 +1,485 @@
+// Package runtime runs a pack step as a coretexOS worker. A step is a typed
+// handler; the runtime connects to NATS, Redis and the gateway, decodes the
+// job's context into the handler's input, stores its output as the job
+// result and reports timing, metrics and heartbeats.
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	_ "expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
+	capsdk "github.com/coretexos/cap/v2/sdk/go"
+	"github.com/coretexos/cap/v2/sdk/go/worker"
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/config"
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
+	"github.com/coretexos/coretex-incident-enricher/internal/gatewayclient"
+	"github.com/coretexos/coretex-incident-enricher/internal/metrics"
+	"github.com/coretexos/coretex-incident-enricher/internal/store"
+	"github.com/coretexos/coretex-incident-enricher/internal/tracing"
+	"github.com/coretexos/coretex-incident-enricher/pack"
+)
+
+// Handler is one step: it turns the decoded job context into the step's
+// result and the artifact pointers it produced. Errors are classified with
+// failure.Classify, so handlers tag bad input and policy denials with
+// failure.New or failure.Errorf to keep them from being retried.
+type Handler[In, Out any] func(ctx context.Context, in In) (Out, []string, error)
+
+// Runtime holds the connections shared by a worker's handler.
+type Runtime struct {
+	Service string
+	Config  config.Env
+	NATS    *nats.Conn
+	Store   *store.Store
+	Gateway *gatewayclient.Client
+
+	// slots bounds concurrent jobs at WORKER_MAX_PARALLEL; its length is
+	// the in-flight count reported in heartbeats.
+	slots chan struct{}
+	// jobTimeout bounds each job's context; see Run.
+	jobTimeout time.Duration
+	// sub is the job subscription, drained on SIGTERM so the queue group
+	// routes new jobs to other workers.
+	sub *nats.Subscription
+	// draining is set on SIGTERM: heartbeats carry a draining label and jobs
+	// still buffered for the subscription are rejected as worker_draining.
+	// Cancelling jobsCtx aborts in-flight jobs once the drain deadline passes.
+	draining   atomic.Bool
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+
+	shutdownTracing func(context.Context) error
+}
+
+// drainCancelGrace is how long cancelled jobs get to report their failure
+// before the connection closes.
+const drainCancelGrace = 5 * time.Second
+
+type jobKey struct{}
+
+var jobsRejected = metrics.NewCounter("jobs_rejected_total", "Jobs answered with a FAILED result without running, by service and error code.", "service", "code")
+
+// New loads the service's configuration and connects to NATS and Redis.
+// It also starts tracing and the metrics and debug listeners when
+// configured.
+func New(service string) (*Runtime, error) {
+	cfg := config.Load(service)
+	shutdownTracing, err := tracing.Init(service, cfg.TracesExporter)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := nats.Connect(cfg.NATSURL)
+	if err != nil {
+		return nil, fmt.Errorf("connect nats: %w", err)
+	}
+	mem, err := store.New(cfg.RedisURL, cfg.DataTTL)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	metrics.Serve(cfg.MetricsAddr, service)
+	if cfg.DebugAddr != "" {
+		// Serves /debug/vars: Go runtime memstats and the command line.
+		go func() {
+			if err := http.ListenAndServe(cfg.DebugAddr, nil); err != nil {
+				log.Printf("%s: debug listener: %v", service, err)
+			}
+		}()
+	}
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	return &Runtime{
+		Service:    service,
+		Config:     cfg,
+		NATS:       nc,
+		Store:      mem,
+		Gateway:    gatewayclient.New(cfg.GatewayURL, cfg.APIKey),
+		jobsCtx:    jobsCtx,
+		cancelJobs: cancelJobs,
+
+		shutdownTracing: shutdownTracing,
+	}, nil
+}
+
+// Close closes the NATS connection and flushes pending spans.
+func (rt *Runtime) Close() {
+	rt.NATS.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rt.shutdownTracing(ctx); err != nil {
+		log.Printf("%s: flush traces: %v", rt.Service, err)
+	}
+}
+
+// Job returns the request being handled, for handlers that need the job id,
+// env or meta labels.
+func Job(ctx context.Context) *agentv1.JobRequest {
+	req, _ := ctx.Value(jobKey{}).(*agentv1.JobRequest)
+	if req == nil {
+		return &agentv1.JobRequest{}
+	}
+	return req
+}
+
+// Run subscribes handler to the worker's job subject and serves jobs until
+// SIGINT or SIGTERM, then drains: the subscription is closed so no new jobs
+// arrive, in-flight jobs get WORKER_DRAIN_TIMEOUT to finish and are
+// cancelled with a failed result after that. topic names the pack job topic
+// for the startup log.
+//
+// Run opens one queue subscription on the subject and runs up to
+// WORKER_MAX_PARALLEL jobs from it at once; see dispatcher.
+//
+// Each job's context has a deadline of WORKER_JOB_TIMEOUT, defaulting to the
+// topic's timeout_seconds in pack/overlays/timeouts.patch.yaml, so a handler
+// gives up and reports TIMEOUT no later than the scheduler would.
+func Run[In, Out any](rt *Runtime, topic string, handler Handler[In, Out]) error {
+	cfg := rt.Config
+	parallel := cfg.MaxParallelJobs
+	if parallel < 1 {
+		parallel = 1
+	}
+	rt.slots = make(chan struct{}, parallel)
+	rt.jobTimeout = cfg.JobTimeout
+	if rt.jobTimeout <= 0 {
+		rt.jobTimeout = pack.TopicTimeout(topic)
+	}
+	subject := fmt.Sprintf("worker.%s.jobs", cfg.WorkerID)
+	w := &worker.Worker{
+		NATS:     &dispatcher{rt: rt},
+		Subject:  subject,
+		Handler:  metrics.InstrumentJobs(rt.Service, jobHandler(rt, handler)),
+		SenderID: cfg.WorkerID,
+	}
+	if err := w.Start(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	// Heartbeats continue through the drain so the scheduler sees it.
+	hbCtx, hbCancel := context.WithCancel(context.Background())
+	defer hbCancel()
+	go worker.HeartbeatLoop(hbCtx, rt.NATS, rt.heartbeat)
+
+	log.Printf("%s listening on %s for %s (worker_id=%s pool=%s parallel=%d job_timeout=%s)", rt.Service, subject, topic, cfg.WorkerID, cfg.WorkerPool, parallel, rt.jobTimeout)
+	<-ctx.Done()
+	rt.drain()
+	return nil
+}
+
+// drain leaves the queue group and waits for in-flight jobs, cancelling any
+// still running at the deadline.
+func (rt *Runtime) drain() {
+	rt.draining.Store(true)
+	if payload, err := rt.heartbeat(); err == nil {
+		_ = worker.EmitHeartbeat(rt.NATS, payload)
+	}
+	// Drain unsubscribes at the server, then passes messages already
+	// buffered here to the callback, which rejects them so the scheduler
+	// retries them elsewhere; the results are flushed below.
+	if rt.sub != nil {
+		if err := rt.sub.Drain(); err != nil {
+			log.Printf("%s: drain subscription: %v", rt.Service, err)
+		}
+	}
+	timeout := rt.Config.DrainTimeout
+	log.Printf("%s draining: %d job(s) in flight, waiting up to %s", rt.Service, len(rt.slots), timeout)
+	if !rt.waitIdle(timeout) {
+		log.Printf("%s: drain deadline passed, cancelling %d job(s)", rt.Service, len(rt.slots))
+		rt.cancelJobs()
+		rt.waitIdle(drainCancelGrace)
+	}
+	if err := rt.NATS.Flush(); err != nil {
+		log.Printf("%s: flush results: %v", rt.Service, err)
+	}
+	log.Printf("%s drained", rt.Service)
+}
+
+// waitIdle reports whether every slot was free before timeout.
+func (rt *Runtime) waitIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for len(rt.slots) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
+
+// heartbeat builds the heartbeat packet with the live in-flight count and a
+// draining label during shutdown.
+func (rt *Runtime) heartbeat() ([]byte, error) {
+	cfg := rt.Config
+	active, parallel := len(rt.slots), cap(rt.slots)
+	hb := &agentv1.Heartbeat{
+		WorkerId:        cfg.WorkerID,
+		Pool:            cfg.WorkerPool,
+		ActiveJobs:      int32(active),
+		MaxParallelJobs: int32(parallel),
+		CpuLoad:         utilization(active, parallel),
+	}
+	if rt.draining.Load() {
+		hb.Labels = map[string]string{"draining": "true"}
+	}
+	return proto.Marshal(&agentv1.BusPacket{
+		SenderId:        cfg.WorkerID,
+		ProtocolVersion: capsdk.DefaultProtocolVersion,
+		Payload:         &agentv1.BusPacket_Heartbeat{Heartbeat: hb},
+	})
+}
+
+// dispatcher is the worker SDK's view of the NATS connection. The SDK runs
+// a subscription's callback serially, so the dispatcher takes a slot for
+// each message and runs the SDK callback, which decodes the job, calls the
+// handler and publishes the result, on its own goroutine.
+//
+// A job that arrives with every slot busy is answered at once with a FAILED
+// result whose error_code is worker_busy, so the scheduler retries it on
+// another worker instead of the job waiting on, or looping back to, this
+// one. It uses one of the topic's retries. Jobs buffered when the worker
+// starts draining are answered the same way with worker_draining: the
+// worker has left the queue group, so re-publishing them could reach no
+// one.
+type dispatcher struct {
+	rt *Runtime
+}
+
+func (d *dispatcher) Publish(subject string, data []byte) error {
+	return d.rt.NATS.Publish(subject, data)
+}
+
+func (d *dispatcher) QueueSubscribe(subject, queue string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	sub, err := d.rt.NATS.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		if d.rt.draining.Load() {
+			d.reject(msg, "worker_draining", "worker is shutting down")
+			return
+		}
+		select {
+		case d.rt.slots <- struct{}{}:
+		default:
+			d.reject(msg, "worker_busy", fmt.Sprintf("all %d slots busy", cap(d.rt.slots)))
+			return
+		}
+		go func() {
+			defer func() { <-d.rt.slots }()
+			cb(msg)
+		}()
+	})
+	d.rt.sub = sub
+	return sub, err
+}
+
+// reject publishes a FAILED result with code for a job the worker will not
+// run.
+func (d *dispatcher) reject(msg *nats.Msg, code, message string) {
+	jobID, data, err := rejection(msg.Data, d.rt.Config.WorkerID, code, message)
+	if err != nil {
+		log.Printf("%s: reject job: %v", d.rt.Service, err)
+		return
+	}
+	jobsRejected.Inc(d.rt.Service, code)
+	log.Printf("%s: rejected job %s (%s): %s", d.rt.Service, jobID, code, message)
+	if err := d.rt.NATS.Publish(capsdk.SubjectResult, data); err != nil {
+		log.Printf("%s: publish result for rejected job %s: %v", d.rt.Service, jobID, err)
+	}
+}
+
+// rejection builds the result packet for the job request packet in data,
+// the way the worker SDK answers a failed job.
+func rejection(data []byte, workerID, code, message string) (jobID string, out []byte, err error) {
+	var packet agentv1.BusPacket
+	if err := proto.Unmarshal(data, &packet); err != nil {
+		return "", nil, fmt.Errorf("decode packet: %w", err)
+	}
+	req := packet.GetJobRequest()
+	if req == nil {
+		return "", nil, errors.New("packet carries no job request")
+	}
+	out, err = proto.Marshal(&agentv1.BusPacket{
+		TraceId:         packet.GetTraceId(),
+		SenderId:        workerID,
+		ProtocolVersion: capsdk.DefaultProtocolVersion,
+		CreatedAt:       timestamppb.Now(),
+		Payload: &agentv1.BusPacket_JobResult{JobResult: &agentv1.JobResult{
+			JobId:        req.GetJobId(),
+			Status:       agentv1.JobStatus_JOB_STATUS_FAILED,
+			WorkerId:     workerID,
+			ErrorCode:    code,
+			ErrorMessage: message,
+		}},
+	})
+	return req.GetJobId(), out, err
+}
+
+func (rt *Runtime) failed(req *agentv1.JobRequest, code, message string) *agentv1.JobResult {
+	return &agentv1.JobResult{
+		JobId:        req.GetJobId(),
+		Status:       agentv1.JobStatus_JOB_STATUS_FAILED,
+		WorkerId:     rt.Config.WorkerID,
+		ErrorCode:    code,
+		ErrorMessage: message,
+	}
+}
+
+// utilization is the share of busy slots as a 0-100 load figure.
+func utilization(active, parallel int) float32 {
+	return float32(active) * 100 / float32(parallel)
+}
+
+// jobHandler adapts a typed handler to the worker SDK: it resolves the
+// context pointer, decodes the input, stores the output with PutResultJSON
+// and builds the JobResult. A failed job is reported with the status and
+// error code of its failure.Kind rather than left to the SDK.
+//
+// Each job runs in a consumer span that continues the trace context found
+// in its input (see jobTraceCarrier), so the steps of one run share the
+// webhook's trace.
+func jobHandler[In, Out any](rt *Runtime, handler Handler[In, Out]) worker.Handler {
+	return func(ctx context.Context, req *agentv1.JobRequest) (*agentv1.JobResult, error) {
+		start := time.Now()
+		data, loadErr := loadContext(ctx, rt, req)
+		ctx = tracing.Extract(ctx, jobTraceCarrier(req, data))
+		ctx, span := tracing.Start(ctx, "job "+req.GetTopic(), trace.SpanKindConsumer,
+			attribute.String("job.id", req.GetJobId()),
+			attribute.String("job.topic", req.GetTopic()),
+			attribute.String("workflow.id", req.GetWorkflowId()),
+			attribute.Int("workflow.step_index", int(req.GetStepIndex())),
+			attribute.String("worker.id", rt.Config.WorkerID),
+		)
+		defer span.End()
+		ctx = context.WithValue(ctx, jobKey{}, req)
+		var cancel context.CancelFunc
+		if rt.jobTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, rt.jobTimeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+		defer context.AfterFunc(rt.jobsCtx, cancel)()
+		var result *agentv1.JobResult
+		err := loadErr
+		if err == nil {
+			result, err = runJob(ctx, rt, req, data, handler, start)
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if rt.jobsCtx.Err() != nil {
+				log.Printf("%s: job %s cancelled by shutdown after %s: %v", rt.Service, req.GetJobId(), time.Since(start).Round(time.Millisecond), err)
+				span.SetAttributes(attribute.String("job.error_code", "worker_shutdown"))
+				return rt.failed(req, "worker_shutdown", "cancelled by worker shutdown: "+err.Error()), nil
+			}
+			kind := failure.Classify(err)
+			log.Printf("%s: job %s failed (%s) after %s: %v", rt.Service, req.GetJobId(), kind, time.Since(start).Round(time.Millisecond), err)
+			span.SetAttributes(attribute.String("job.error_code", string(kind)))
+			result := rt.failed(req, string(kind), err.Error())
+			result.Status = kind.Status()
+			result.ExecutionMs = time.Since(start).Milliseconds()
+			return result, nil
+		}
+		log.Printf("%s: job %s succeeded in %s", rt.Service, req.GetJobId(), time.Since(start).Round(time.Millisecond))
+		return result, nil
+	}
+}
+
+// loadContext reads the job's context JSON from its context pointer.
+func loadContext(ctx context.Context, rt *Runtime, req *agentv1.JobRequest) ([]byte, error) {
+	ptr := contextPtr(req)
+	if ptr == "" {
+		return nil, failure.Errorf(failure.Validation, "job has no context pointer")
+	}
+	data, err := rt.Store.GetByPointer(ctx, ptr)
+	if err != nil {
+		return nil, contextError(err)
+	}
+	return data, nil
+}
+
+// jobTraceCarrier returns the trace context the ingester put in the run
+// input under tracing.InputField: at the top level for steps that take the
+// run input itself, or under "incident" for steps that embed it. Jobs
+// without one fall back to JobRequest.Env.
+func jobTraceCarrier(req *agentv1.JobRequest, data []byte) propagation.MapCarrier {
+	var input map[string]json.RawMessage
+	if json.Unmarshal(data, &input) == nil {
+		var incident map[string]json.RawMessage
+		_ = json.Unmarshal(input["incident"], &incident)
+		for _, raw := range []json.RawMessage{input[tracing.InputField], incident[tracing.InputField]} {
+			var carrier map[string]string
+			if json.Unmarshal(raw, &carrier) == nil && len(carrier) > 0 {
+				return carrier
+			}
+		}
+	}
+	return propagation.MapCarrier(req.GetEnv())
+}
+
+func runJob[In, Out any](ctx context.Context, rt *Runtime, req *agentv1.JobRequest, data []byte, handler Handler[In, Out], start time.Time) (*agentv1.JobResult, error) {
+	var input In
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, contextError(fmt.Errorf("unmarshal context: %w", err))
+	}
+	output, artifactPtrs, err := handler(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	resultPtr, err := rt.Store.PutResultJSON(ctx, req.GetJobId(), output)
+	if err != nil {
+		return nil, err
+	}
+	if artifactPtrs == nil {
+		artifactPtrs = []string{}
+	}
+	return &agentv1.JobResult{
+		JobId:        req.GetJobId(),
+		Status:       agentv1.JobStatus_JOB_STATUS_SUCCEEDED,
+		ResultPtr:    resultPtr,
+		WorkerId:     rt.Config.WorkerID,
+		ExecutionMs:  time.Since(start).Milliseconds(),
+		ArtifactPtrs: artifactPtrs,
+	}, nil
+}
+
+// contextError tags a job context that is missing or does not decode as a
+// validation failure; redis errors stay transient.
+func contextError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, redis.Nil):
+		return failure.Errorf(failure.Validation, "job context not found")
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return failure.New(failure.Validation, err)
+	}
+	return err
+}
+
+// contextPtr is the job's context pointer, falling back to the
+// context_ptr env entry.
+func contextPtr(req *agentv1.JobRequest) string {
+	if ptr := req.GetContextPtr(); ptr != "" {
+		return ptr
+	}
+	return req.GetEnv()["context_ptr"]
+}
@@ -0,0 +1,49 @@
+package runtime
+
+import (
+	"testing"
+
+	agentv1 "github.com/coretexos/cap/v2/coretex/agent/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRejection(t *testing.T) {
+	data, err := proto.Marshal(&agentv1.BusPacket{
+		TraceId:  "trace-1",
+		SenderId: "scheduler",
+		Payload:  &agentv1.BusPacket_JobRequest{JobRequest: &agentv1.JobRequest{JobId: "job-1", Topic: "job.incident-enricher.fetch"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobID, out, err := rejection(data, "worker-1", "worker_busy", "all 2 slots busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packet agentv1.BusPacket
+	if err := proto.Unmarshal(out, &packet); err != nil {
+		t.Fatal(err)
+	}
+	res := packet.GetJobResult()
+	if jobID != "job-1" || res.GetJobId() != "job-1" || res.GetWorkerId() != "worker-1" {
+		t.Errorf("result %+v for job %q, want job-1 from worker-1", res, jobID)
+	}
+	if res.GetStatus() != agentv1.JobStatus_JOB_STATUS_FAILED || res.GetErrorCode() != "worker_busy" || res.GetErrorMessage() != "all 2 slots busy" {
+		t.Errorf("result = %s %q %q, want FAILED worker_busy", res.GetStatus(), res.GetErrorCode(), res.GetErrorMessage())
+	}
+	if packet.GetTraceId() != "trace-1" || packet.GetSenderId() != "worker-1" || packet.GetCreatedAt() == nil {
+		t.Errorf("packet = %+v, want the request's trace from worker-1", &packet)
+	}
+}
+
+func TestRejectionErrors(t *testing.T) {
+	heartbeat, err := proto.Marshal(&agentv1.BusPacket{Payload: &agentv1.BusPacket_Heartbeat{Heartbeat: &agentv1.Heartbeat{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"garbage": []byte("\xff\xff"), "not a job": heartbeat} {
+		if _, _, err := rejection(data, "worker-1", "worker_busy", ""); err == nil {
+			t.Errorf("%s: rejection built a result", name)
+		}
+	}
+}
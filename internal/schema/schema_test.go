@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/coretexos/coretex-incident-enricher/pack"
+)
+
+func compilePack(t *testing.T, name string) *Schema {
+	t.Helper()
+	data, err := pack.Schema(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Compile(data)
+	if err != nil {
+		t.Fatalf("compile %s: %v", name, err)
+	}
+	return s
+}
+
+// check validates doc against s and compares the violations, rendered with
+// Violation.String, to want.
+func check(t *testing.T, s *Schema, doc string, want ...string) {
+	t.Helper()
+	violations, err := s.ValidateJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(violations))
+	for i, v := range violations {
+		got[i] = v.String()
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("violations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestIncidentInputSchema(t *testing.T) {
+	s := compilePack(t, "IncidentInput")
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{
+			name: "valid",
+			doc: `{"incident_id":"inc-1","event_type":"trigger","severity":"high",
+				"source":{"system":"pager-duty_2","url":"https://example.com","extra":1},
+				"destination":{"mode":"slack","slack_channel":"#ops"},
+				"raw":{"anything":[1,2]},"trace_context":{"traceparent":"00-abc"}}`,
+		},
+		{
+			name: "required",
+			doc:  `{"source":{},"destination":{}}`,
+			want: []string{"destination.mode: is required", "incident_id: is required", "source.system: is required"},
+		},
+		{
+			name: "minLength",
+			doc:  `{"incident_id":"","source":{"system":"x"},"destination":{"mode":"artifact"}}`,
+			want: []string{"incident_id: must be at least 1 character(s)"},
+		},
+		{
+			name: "enum",
+			doc:  `{"incident_id":"i","severity":"sev1","event_type":"ack","source":{"system":"x"},"destination":{"mode":"email"}}`,
+			want: []string{
+				"destination.mode: must be one of [artifact, slack]",
+				"event_type: must be one of [trigger, update, resolve]",
+				"severity: must be one of [low, medium, high, critical]",
+			},
+		},
+		{
+			name: "pattern",
+			doc:  `{"incident_id":"i","source":{"system":"PagerDuty"},"destination":{"mode":"artifact"}}`,
+			want: []string{"source.system: must match ^[a-z0-9][a-z0-9_-]*$"},
+		},
+		{
+			name: "type",
+			doc:  `{"incident_id":7,"source":"pagerduty","destination":{"mode":"artifact"},"raw":[]}`,
+			want: []string{"incident_id: expected string, got number", "raw: expected object, got array", "source: expected object, got string"},
+		},
+		{
+			name: "additionalProperties false",
+			doc:  `{"incident_id":"i","source":{"system":"x"},"destination":{"mode":"artifact"},"priority":"P1"}`,
+			want: []string{"priority: is not allowed"},
+		},
+		{
+			name: "not an object",
+			doc:  `["inc-1"]`,
+			want: []string{"expected object, got array"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check(t, s, tt.doc, tt.want...)
+		})
+	}
+}
+
+func TestSummarySchema(t *testing.T) {
+	s := compilePack(t, "Summary")
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{
+			name: "valid",
+			doc: `{"incident_id":"inc-1","summary_md":"ok","highlights":["a"],"confidence":1,
+				"coverage":{"items_total":2,"chunks":1},
+				"citations":[{"quote":"q","offset":3,"verified":true}],
+				"attempts":[{"provider":"openai","attempts":2}]}`,
+		},
+		{
+			name: "items",
+			doc:  `{"incident_id":"i","summary_md":"ok","highlights":["a",{"text":"b"}],"action_items":"do it"}`,
+			want: []string{"action_items: expected array, got string", "highlights[1]: expected string, got object"},
+		},
+		{
+			name: "minimum and maximum",
+			doc:  `{"incident_id":"i","summary_md":"ok","confidence":1.5,"citations":[{"quote":"q","offset":-1}]}`,
+			want: []string{"citations[0].offset: must be >= 0", "confidence: must be <= 1"},
+		},
+		{
+			name: "integer",
+			doc:  `{"incident_id":"i","summary_md":"ok","coverage":{"chunks":1.5}}`,
+			want: []string{"coverage.chunks: expected integer, got number"},
+		},
+		{
+			name: "nested required and additionalProperties",
+			doc:  `{"incident_id":"i","summary_md":"ok","attempts":[{"attempts":1,"latency":3}]}`,
+			want: []string{"attempts[0].latency: is not allowed", "attempts[0].provider: is required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check(t, s, tt.doc, tt.want...)
+		})
+	}
+}
+
+func TestTypeList(t *testing.T) {
+	s, err := Compile([]byte(`{"type":["string","null"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, s, `null`)
+	check(t, s, `"x"`)
+	check(t, s, `1`, "expected string or null, got number")
+}
+
+func TestCompileErrors(t *testing.T) {
+	if _, err := Compile([]byte(`{"properties":{"id":{"pattern":"("}}}`)); err == nil || !strings.Contains(err.Error(), "schema id: invalid pattern") {
+		t.Errorf("invalid nested pattern: err = %v", err)
+	}
+	if _, err := Compile([]byte(`{"additionalProperties":{"type":"string"}}`)); err == nil {
+		t.Error("schema-valued additionalProperties compiled; only booleans are supported")
+	}
+}
@@ -0,0 +1,83 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
+	"github.com/coretexos/coretex-incident-enricher/internal/types"
+)
+
+// APIURL is the Slack Web API endpoint for chat.postMessage.
+const APIURL = "https://slack.com/api/chat.postMessage"
+
+// transientAPIErrors are chat.postMessage error codes worth retrying; the
+// rest (invalid_auth, channel_not_found, not_in_channel, ...) will not clear
+// on their own.
+var transientAPIErrors = map[string]bool{
+	"ratelimited":         true,
+	"rate_limited":        true,
+	"service_unavailable": true,
+	"internal_error":      true,
+	"fatal_error":         true,
+	"request_timeout":     true,
+}
+
+// PostMessage posts message to channel with a bot token. Unlike incoming
+// webhooks the reply carries the message ts, so later posts can thread onto
+// it via threadTS; broadcast also shows a thread reply in the channel.
+func PostMessage(ctx context.Context, token, channel, message, threadTS string, broadcast bool) (result *types.SlackResult, err error) {
+	ctx, span := startPost(ctx, "api", attribute.String("slack.channel", channel))
+	defer func() { observePost(span, "api", err) }()
+	payload := map[string]any{
+		"channel": channel,
+		"text":    message,
+	}
+	if threadTS != "" {
+		payload["thread_ts"] = threadTS
+		if broadcast {
+			payload["reply_broadcast"] = true
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal slack payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, APIURL, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("build slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("slack request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		OK      bool   `json:"ok"`
+		Channel string `json:"channel"`
+		Ts      string `json:"ts"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, failure.HTTP(resp.StatusCode, fmt.Errorf("decode slack response (%s): %w", resp.Status, err))
+	}
+	result = &types.SlackResult{OK: body.OK, Channel: body.Channel, Ts: body.Ts, ThreadTs: threadTS}
+	if !body.OK {
+		result.Error = body.Error
+		err := fmt.Errorf("slack api error: %s", body.Error)
+		if transientAPIErrors[body.Error] {
+			return result, failure.New(failure.UpstreamTransient, err)
+		}
+		return result, failure.New(failure.UpstreamPermanent, err)
+	}
+	return result, nil
+}
@@ -10,10 +10,38 @@ import (
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/coretexos/coretex-incident-enricher/internal/failure"
+	"github.com/coretexos/coretex-incident-enricher/internal/metrics"
+	"github.com/coretexos/coretex-incident-enricher/internal/tracing"
 	"github.com/coretexos/coretex-incident-enricher/internal/types"
 )
 
-func PostWebhook(ctx context.Context, webhookURL string, message string) (*types.SlackResult, error) {
+// posts counts Slack posts by method (webhook or api) and outcome.
+var posts = metrics.NewCounter("slack_posts_total", "Slack posts, by method (webhook or api) and outcome.", "method", "outcome")
+
+// startPost starts the client span for one post. Webhook URLs carry a
+// secret and are never recorded.
+func startPost(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attribute.String("slack.method", method))
+	return tracing.Start(ctx, "slack.post", trace.SpanKindClient, attrs...)
+}
+
+// observePost counts the post and ends its span.
+func observePost(span trace.Span, method string, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	posts.Inc(method, outcome)
+	tracing.End(span, err)
+}
+
+func PostWebhook(ctx context.Context, webhookURL string, message string) (result *types.SlackResult, err error) {
+	ctx, span := startPost(ctx, "webhook")
+	defer func() { observePost(span, "webhook", err) }()
 	payload := map[string]string{"text": message}
 	data, err := json.Marshal(payload)
 	if err != nil {
@@ -32,7 +60,7 @@ func PostWebhook(ctx context.Context, webhookURL string, message string) (*types
 	defer resp.Body.Close()
 	body, _ := io.ReadAll(resp.Body)
 	text := strings.TrimSpace(string(body))
-	result := &types.SlackResult{OK: resp.StatusCode >= 200 && resp.StatusCode < 300}
+	result = &types.SlackResult{OK: resp.StatusCode >= 200 && resp.StatusCode < 300}
 	if result.OK && (text == "" || text == "ok") {
 		result.OK = true
 		return result, nil
@@ -42,5 +70,5 @@ func PostWebhook(ctx context.Context, webhookURL string, message string) (*types
 		text = resp.Status
 	}
 	result.Error = text
-	return result, fmt.Errorf("slack webhook error: %s", text)
+	return result, failure.HTTP(resp.StatusCode, fmt.Errorf("slack webhook error: %s", text))
 }
@@ -34,6 +34,7 @@ func New(redisURL string, ttl time.Duration) (*Store, error) {
 		opts = &redis.Options{Addr: redisURL}
 	}
 	client := redis.NewClient(opts)
+	client.AddHook(tracingHook{})
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	if err := client.Ping(ctx).Err(); err != nil {
@@ -42,10 +43,27 @@ func New(redisURL string, ttl time.Duration) (*Store, error) {
 	return &Store{client: client, ttl: ttl}, nil
 }
 
+// NewFromClient wraps an existing client without pinging it, for callers
+// that configure the connection (or its hooks) themselves.
+func NewFromClient(client *redis.Client, ttl time.Duration) *Store {
+	client.AddHook(tracingHook{})
+	return &Store{client: client, ttl: ttl}
+}
+
 func (s *Store) Client() *redis.Client {
 	return s.client
 }
 
+// TTL is the data TTL PutJSON applies.
+func (s *Store) TTL() time.Duration {
+	return s.ttl
+}
+
+// Ping checks the Redis connection.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
 func (s *Store) GetContextJSON(ctx context.Context, ptr string, out any) error {
 	data, err := s.GetByPointer(ctx, ptr)
 	if err != nil {
@@ -104,6 +122,51 @@ func (s *Store) SetKey(ctx context.Context, key string, value []byte, ttl time.D
 	return nil
 }
 
+// GetJSON loads a JSON value stored under key, reporting false when the key
+// does not exist.
+func (s *Store) GetJSON(ctx context.Context, key string, out any) (bool, error) {
+	data, err := s.GetKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, fmt.Errorf("unmarshal %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// PutJSON stores value under key with the store's data TTL.
+func (s *Store) PutJSON(ctx context.Context, key string, value any) error {
+	return s.PutJSONTTL(ctx, key, value, s.ttl)
+}
+
+// PutJSONTTL stores value under key with an explicit TTL.
+func (s *Store) PutJSONTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", key, err)
+	}
+	return s.SetKey(ctx, key, data, ttl)
+}
+
+// ClaimJSON stores value under key with ttl only if key does not exist yet
+// (SET NX), reporting whether this call created it.
+func (s *Store) ClaimJSON(ctx context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("marshal %s: %w", key, err)
+	}
+	return s.client.SetNX(ctx, key, data, ttl).Result()
+}
+
+// DeleteKey removes key; a missing key is not an error.
+func (s *Store) DeleteKey(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
 func contextKey(jobID string) string {
 	return "ctx:" + jobID
 }
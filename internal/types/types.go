@@ -1,13 +1,22 @@
 package types
 
+// Incident event types. Triggers start the enrich workflow; updates and
+// resolves follow up on the post made for the trigger.
+const (
+	EventTrigger = "trigger"
+	EventUpdate  = "update"
+	EventResolve = "resolve"
+)
+
 // IncidentInput is the workflow input schema.
 type IncidentInput struct {
-	IncidentID  string      `json:"incident_id"`
-	Title       string      `json:"title,omitempty"`
-	Severity    string      `json:"severity,omitempty"`
-	Source      SourceInfo  `json:"source"`
+	IncidentID  string         `json:"incident_id"`
+	EventType   string         `json:"event_type,omitempty"`
+	Title       string         `json:"title,omitempty"`
+	Severity    string         `json:"severity,omitempty"`
+	Source      SourceInfo     `json:"source"`
 	Raw         map[string]any `json:"raw,omitempty"`
-	Destination Destination `json:"destination"`
+	Destination Destination    `json:"destination"`
 }
 
 type SourceInfo struct {
@@ -18,6 +27,7 @@ type SourceInfo struct {
 type Destination struct {
 	Mode            string `json:"mode"`
 	SlackWebhookURL string `json:"slack_webhook_url,omitempty"`
+	SlackChannel    string `json:"slack_channel,omitempty"`
 }
 
 type EvidenceItem struct {
@@ -36,25 +46,58 @@ type EvidenceBundle struct {
 }
 
 type Summary struct {
-	IncidentID      string   `json:"incident_id"`
-	SummaryMarkdown string   `json:"summary_md"`
-	Highlights      []string `json:"highlights,omitempty"`
-	ActionItems     []string `json:"action_items,omitempty"`
-	Confidence      float64  `json:"confidence,omitempty"`
-	Model           string   `json:"model,omitempty"`
-	ArtifactPtr     string   `json:"artifact_ptr,omitempty"`
+	IncidentID      string            `json:"incident_id"`
+	SummaryMarkdown string            `json:"summary_md"`
+	Highlights      []string          `json:"highlights,omitempty"`
+	ActionItems     []string          `json:"action_items,omitempty"`
+	Confidence      float64           `json:"confidence,omitempty"`
+	Model           string            `json:"model,omitempty"`
+	ArtifactPtr     string            `json:"artifact_ptr,omitempty"`
+	Attempts        []ProviderAttempt `json:"attempts,omitempty"`
+	Coverage        *EvidenceCoverage `json:"coverage,omitempty"`
+	Citations       []Citation        `json:"citations,omitempty"`
+	Cached          bool              `json:"cached,omitempty"`
+}
+
+// Citation ties a quoted line in a summary to the evidence artifact it came
+// from. Offset is a byte offset into the evidence text given to the model and
+// is only meaningful when Verified is true.
+type Citation struct {
+	ArtifactPtr string `json:"artifact_ptr,omitempty"`
+	Quote       string `json:"quote"`
+	Offset      int    `json:"offset"`
+	Verified    bool   `json:"verified"`
+}
+
+// EvidenceCoverage reports how much of the evidence bundle reached the model.
+type EvidenceCoverage struct {
+	ItemsTotal    int   `json:"items_total"`
+	ItemsIncluded int   `json:"items_included"`
+	BytesTotal    int64 `json:"bytes_total"`
+	BytesIncluded int64 `json:"bytes_included"`
+	Chunks        int   `json:"chunks,omitempty"`
+}
+
+// ProviderAttempt records one provider tried by the summarizer's fallback chain.
+type ProviderAttempt struct {
+	Provider string `json:"provider"`
+	Attempts int    `json:"attempts,omitempty"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 type SlackResult struct {
 	OK        bool   `json:"ok"`
 	Channel   string `json:"channel,omitempty"`
 	Ts        string `json:"ts,omitempty"`
+	ThreadTs  string `json:"thread_ts,omitempty"`
 	Permalink string `json:"permalink,omitempty"`
 	Error     string `json:"error,omitempty"`
 }
 
 type PostResult struct {
 	IncidentID  string       `json:"incident_id"`
+	EventType   string       `json:"event_type,omitempty"`
 	Mode        string       `json:"mode"`
 	Slack       *SlackResult `json:"slack,omitempty"`
 	ArtifactPtr string       `json:"artifact_ptr,omitempty"`
@@ -0,0 +1,45 @@
+// Package pack embeds the pack resources that workers need at runtime so they
+// stay in sync with what install.sh registers in coretexOS.
+package pack
+
+import (
+	"embed"
+	"io/fs"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed schemas/*.json prompts/*.tmpl overlays/timeouts.patch.yaml
+var FS embed.FS
+
+func Schema(name string) ([]byte, error) {
+	return FS.ReadFile("schemas/" + name + ".json")
+}
+
+// Prompts returns the prompt templates shipped under prompts/.
+func Prompts() fs.FS {
+	sub, err := fs.Sub(FS, "prompts")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// TopicTimeout returns the timeout_seconds that overlays/timeouts.patch.yaml
+// sets for topic, or 0 when the overlay has none.
+func TopicTimeout(topic string) time.Duration {
+	data, err := FS.ReadFile("overlays/timeouts.patch.yaml")
+	if err != nil {
+		panic(err)
+	}
+	var overlay struct {
+		Topics map[string]struct {
+			TimeoutSeconds int `yaml:"timeout_seconds"`
+		} `yaml:"topics"`
+	}
+	if err := yaml.Unmarshal(data, &overlay); err != nil {
+		panic(err)
+	}
+	return time.Duration(overlay.Topics[topic].TimeoutSeconds) * time.Second
+}
@@ -8,7 +8,7 @@ ARCHIVE="$DIST/incident-enricher-${VERSION}.tgz"
 
 mkdir -p "$DIST"
 
-tar -czf "$ARCHIVE" -C "$ROOT/pack" .
+tar -czf "$ARCHIVE" --exclude="*.go" -C "$ROOT/pack" .
 
 echo "bundle: $ARCHIVE"
 if command -v sha256sum >/dev/null 2>&1; then